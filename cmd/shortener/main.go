@@ -1,18 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/kuznet1/urlshrt/internal/config"
 	"github.com/kuznet1/urlshrt/internal/handler"
+	"github.com/kuznet1/urlshrt/internal/health"
 	"github.com/kuznet1/urlshrt/internal/middleware"
+	"github.com/kuznet1/urlshrt/internal/ratelimit"
 	"github.com/kuznet1/urlshrt/internal/repository"
 	"github.com/kuznet1/urlshrt/internal/service"
 	"github.com/kuznet1/urlshrt/internal/service/audit"
+	"github.com/kuznet1/urlshrt/internal/service/policy"
+	"github.com/kuznet1/urlshrt/internal/tracing"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 var (
@@ -41,45 +50,166 @@ func main() {
 		log.Fatal(err)
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg, buildVersion)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
 	repo, err := repository.NewRepo(cfg, logger)
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	svc := service.NewService(repo, cfg, logger)
+	err = svc.RenormalizeURLs(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go svc.RunPurge(bgCtx)
+
+	destPolicy, err := policy.NewPolicy(cfg, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc.SetPolicy(destPolicy)
+	go destPolicy.Watch(bgCtx)
+
+	checker := health.NewChecker(cfg.HealthCheckTimeout)
+	if cfg.DatabaseDSN != "" {
+		checker.Add("storage", repo.Ping)
+	} else if cfg.FileStoragePath != "" {
+		// the memory storage has nothing to ping, only its file can fail
+		checker.Add("file_store", health.FileWritable(cfg.FileStoragePath))
+	}
+	checker.Add("deletion_worker", func(context.Context) error { return repo.WorkerAlive() })
 
 	if cfg.AuditFile != "" {
-		listener, err := audit.NewFile(cfg.AuditFile)
+		listener, err := audit.NewFile(cfg)
 		if err != nil {
 			log.Fatal(err)
 		}
 		defer listener.Close()
 		svc.Subscribe(listener)
+		checker.Add("audit_file", listener.Ping)
+
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go func() {
+			for range hup {
+				err := listener.Reopen()
+				if err != nil {
+					logger.Error("failed to reopen audit file", zap.Error(err))
+				}
+			}
+		}()
 	}
 
 	if cfg.AuditURL != "" {
-		svc.Subscribe(audit.NewURLAudit(cfg.AuditURL))
+		listener, err := audit.NewURLAudit(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		svc.Subscribe(listener)
+		checker.Add("audit_url", listener.Ping)
+	}
+
+	if cfg.AuditSyslog != "" {
+		listener, err := audit.NewSyslogAudit(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer listener.Close()
+		svc.Subscribe(listener)
+		checker.Add("audit_syslog", listener.Ping)
+	}
+
+	if cfg.DatabaseDSN != "" {
+		dbAudit, err := audit.NewDBAudit(cfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer dbAudit.Close()
+		svc.Subscribe(dbAudit)
+		checker.Add("audit_db", dbAudit.Ping)
+		svc.SetAuditReader(dbAudit)
+	} else if cfg.AuditFile != "" {
+		reader := audit.NewFileReader(cfg.AuditFile)
+		defer reader.Close()
+		svc.SetAuditReader(reader)
 	}
 
 	h := handler.NewHandler(svc, logger)
 	requestLogger := middleware.NewRequestLogger(logger)
-	auth := middleware.NewAuth(repo, cfg, logger)
-	mux := chi.NewRouter()
-	mux.Use(requestLogger.Logging, middleware.Compression, auth.Authentication)
-	h.Register(mux)
-	mux.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
-		err := repo.Ping(r.Context())
+	recoverer := middleware.NewRecoverer(logger)
+	auth := middleware.NewAuth(svc, cfg, logger)
+	compressor, err := middleware.NewCompressor(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+	if cfg.RateLimitShared {
+		if cfg.DatabaseDSN == "" {
+			log.Fatal("shared rate limits require a database")
+		}
+		dbLimiter, err := ratelimit.NewDBLimiter(cfg)
 		if err != nil {
-			logger.Error("db conn error", zap.Error(err))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			log.Fatal(err)
 		}
-		w.WriteHeader(http.StatusOK)
+		defer dbLimiter.Close()
+		limiter = dbLimiter
+	}
+	rateLimiter := middleware.NewRateLimiter(limiter, cfg, logger)
+	bodyLimiter := middleware.NewBodyLimiter(cfg)
+	cors, err := middleware.NewCORS(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux := chi.NewRouter()
+	mux.Use(requestLogger.Logging, middleware.Tracing, recoverer.Recovery)
+	// health endpoints are probed without cookies, so they must not create users
+	mux.Get("/livez", checker.Livez)
+	mux.Get("/readyz", checker.Readyz)
+	mux.Group(func(r chi.Router) {
+		r.Use(cors.CrossOrigin, compressor.Compression, bodyLimiter.BodyLimit, auth.Authentication)
+		h.WithRateLimits(rateLimiter).Register(r)
+		r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
+			err := repo.Ping(r.Context())
+			if err != nil {
+				logger.Error("db conn error", zap.Error(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		})
 	})
 
-	fmt.Println("Shortener service is starting at", cfg.ListenAddr)
-	err = http.ListenAndServe(cfg.ListenAddr, mux)
-	if err != nil {
+	server := &http.Server{Addr: cfg.ListenAddr, Handler: mux}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Println("Shortener service is starting at", cfg.ListenAddr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatal(err)
+	case <-stop:
+	}
+
+	logger.Info("shutting down", zap.Duration("delay", cfg.ShutdownDelay))
+	checker.ShutDown()
+	stopBackground()
+	time.Sleep(cfg.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	if err != nil {
+		logger.Error("failed to shut down gracefully", zap.Error(err))
 	}
 }
@@ -2,23 +2,68 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"github.com/caarlos0/env"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // Config contains runtime configuration loaded from flags and environment variables.
 // See struct tags for env variable names; command-line flags mirror these fields.
 type Config struct {
-	ListenAddr         string        `env:"SERVER_ADDRESS"`
-	ShortenerPrefix    string        `env:"BASE_URL"`
-	FileStoragePath    string        `env:"FILE_STORAGE_PATH"`
-	DatabaseDSN        string        `env:"DATABASE_DSN"`
-	SecretKey          string        `env:"SECRET_KEY"`
-	DeleteBatchSize    int           `env:"DELETE_BATCH_SIZE"`
-	DeleteBatchTimeout time.Duration `env:"DELETE_BATCH_TIMEOUT"`
-	AuditFile          string        `env:"AUDIT_FILE"`
-	AuditURL           string        `env:"AUDIT_URL"`
-	AuditURLTimeout    time.Duration `env:"AUDIT_URL_REQ_TIMEOUT"`
+	ListenAddr              string        `env:"SERVER_ADDRESS"`
+	ShortenerPrefix         string        `env:"BASE_URL"`
+	FileStoragePath         string        `env:"FILE_STORAGE_PATH"`
+	DatabaseDSN             string        `env:"DATABASE_DSN"`
+	SecretKey               string        `env:"SECRET_KEY"`
+	DeleteBatchSize         int           `env:"DELETE_BATCH_SIZE"`
+	DeleteBatchTimeout      time.Duration `env:"DELETE_BATCH_TIMEOUT"`
+	AuditFile               string        `env:"AUDIT_FILE"`
+	AuditFileMaxSize        int64         `env:"AUDIT_FILE_MAX_SIZE"`
+	AuditFileDaily          bool          `env:"AUDIT_FILE_DAILY"`
+	AuditFileBackups        int           `env:"AUDIT_FILE_BACKUPS"`
+	AuditFileCompress       bool          `env:"AUDIT_FILE_COMPRESS"`
+	AuditURL                string        `env:"AUDIT_URL"`
+	AuditURLTimeout         time.Duration `env:"AUDIT_URL_REQ_TIMEOUT"`
+	AuditFormat             string        `env:"AUDIT_FORMAT"`
+	AuditSource             string        `env:"AUDIT_SOURCE"`
+	AuditSyslog             string        `env:"AUDIT_SYSLOG"`
+	AuditSyslogTag          string        `env:"AUDIT_SYSLOG_TAG"`
+	AdminUsers              []int         `env:"ADMIN_USERS" envSeparator:","`
+	CompressMinSize         int           `env:"COMPRESS_MIN_SIZE"`
+	CompressTypes           []string      `env:"COMPRESS_TYPES" envSeparator:","`
+	CompressLevel           int           `env:"COMPRESS_LEVEL"`
+	RateLimitCreate         float64       `env:"RATE_LIMIT_CREATE"`
+	RateLimitCreateBurst    int           `env:"RATE_LIMIT_CREATE_BURST"`
+	RateLimitRedirect       float64       `env:"RATE_LIMIT_REDIRECT"`
+	RateLimitRedirectBurst  int           `env:"RATE_LIMIT_REDIRECT_BURST"`
+	RateLimitShared         bool          `env:"RATE_LIMIT_SHARED"`
+	MaxBodySize             int64         `env:"MAX_BODY_SIZE"`
+	MaxBatchSize            int           `env:"MAX_BATCH_SIZE"`
+	MaxURLLength            int           `env:"MAX_URL_LENGTH"`
+	AllowedSchemes          []string      `env:"ALLOWED_URL_SCHEMES" envSeparator:","`
+	NormalizeURLs           bool          `env:"NORMALIZE_URLS"`
+	NormalizeSortQuery      bool          `env:"NORMALIZE_SORT_QUERY"`
+	NormalizeStripTracking  bool          `env:"NORMALIZE_STRIP_TRACKING"`
+	AllowedDomains          []string      `env:"ALLOWED_DOMAINS" envSeparator:","`
+	DeniedDomains           []string      `env:"DENIED_DOMAINS" envSeparator:","`
+	BlocklistFile           string        `env:"BLOCKLIST_FILE"`
+	BlocklistReloadInterval time.Duration `env:"BLOCKLIST_RELOAD_INTERVAL"`
+	CORSOrigins             []string      `env:"CORS_ALLOWED_ORIGINS" envSeparator:","`
+	CORSMethods             []string      `env:"CORS_ALLOWED_METHODS" envSeparator:","`
+	CORSHeaders             []string      `env:"CORS_ALLOWED_HEADERS" envSeparator:","`
+	CORSCredentials         bool          `env:"CORS_ALLOW_CREDENTIALS"`
+	CORSMaxAge              time.Duration `env:"CORS_MAX_AGE"`
+	TraceExporter           string        `env:"TRACE_EXPORTER"`
+	TraceEndpoint           string        `env:"TRACE_OTLP_ENDPOINT"`
+	TraceSampleRatio        float64       `env:"TRACE_SAMPLE_RATIO"`
+	HealthCheckTimeout      time.Duration `env:"HEALTH_CHECK_TIMEOUT"`
+	ShutdownDelay           time.Duration `env:"SHUTDOWN_DELAY"`
+	ShutdownTimeout         time.Duration `env:"SHUTDOWN_TIMEOUT"`
+	RestoreWindow           time.Duration `env:"RESTORE_WINDOW"`
+	PurgeRetention          time.Duration `env:"PURGE_RETENTION"`
+	PurgeInterval           time.Duration `env:"PURGE_INTERVAL"`
 }
 
 // ParseArgs populates Config from command-line flags and environment variables.
@@ -32,10 +77,100 @@ func ParseArgs() (Config, error) {
 	flag.StringVar(&cfg.SecretKey, "k", "", "secret key for cookie signing")
 	flag.IntVar(&cfg.DeleteBatchSize, "bs", 1, "delete batch size")
 	flag.DurationVar(&cfg.DeleteBatchTimeout, "t", time.Second, "delete timeout")
+	flag.DurationVar(&cfg.RestoreWindow, "rw", 24*time.Hour, "how long deleted links may be restored, 0 allows restoring at any time")
+	flag.DurationVar(&cfg.PurgeRetention, "pr", 30*24*time.Hour, "how long deleted links are kept before purging, 0 disables purging")
+	flag.DurationVar(&cfg.PurgeInterval, "pi", time.Hour, "how often deleted links are purged")
 	flag.StringVar(&cfg.AuditFile, "af", "", "file to save audit logs")
+	flag.Int64Var(&cfg.AuditFileMaxSize, "afs", 0, "audit file size in bytes that triggers rotation, 0 disables")
+	flag.BoolVar(&cfg.AuditFileDaily, "afd", false, "rotate audit file daily")
+	flag.IntVar(&cfg.AuditFileBackups, "afb", 0, "number of rotated audit files to keep, 0 keeps all")
+	flag.BoolVar(&cfg.AuditFileCompress, "afc", false, "gzip rotated audit files")
 	flag.StringVar(&cfg.AuditURL, "au", "", "url to send audit logs to")
 	flag.DurationVar(&cfg.AuditURLTimeout, "aut", 10*time.Second, "audit request timeout")
+	flag.StringVar(&cfg.AuditFormat, "afmt", "plain", "audit events format: plain or cloudevents")
+	flag.StringVar(&cfg.AuditSource, "asrc", "", "CloudEvents source of audit events, defaults to the shortener prefix")
+	flag.StringVar(&cfg.AuditSyslog, "as", "", "syslog address to send audit logs to, e.g. udp://host:514, tcp://host:514 or unix:///dev/log")
+	flag.StringVar(&cfg.AuditSyslogTag, "ast", "urlshrt", "syslog app name of audit messages")
+	flag.IntVar(&cfg.CompressMinSize, "cms", 1024, "minimum response size in bytes to compress, 0 compresses responses of any size")
+	flag.Func("ct", "comma-separated media types of compressed responses, wildcards like text/* are allowed", func(s string) error {
+		cfg.CompressTypes = parseStringList(s)
+		return nil
+	})
+	flag.IntVar(&cfg.CompressLevel, "cl", 0, "response compression level from 1 (fastest) to 9 (best), 0 for default")
+	flag.Float64Var(&cfg.RateLimitCreate, "rlc", 0, "allowed URL shortening requests per second per client, 0 disables the limit")
+	flag.IntVar(&cfg.RateLimitCreateBurst, "rlcb", 0, "URL shortening requests burst per client, defaults to the rate")
+	flag.Float64Var(&cfg.RateLimitRedirect, "rlr", 0, "allowed redirects per second per client, 0 disables the limit")
+	flag.IntVar(&cfg.RateLimitRedirectBurst, "rlrb", 0, "redirects burst per client, defaults to the rate")
+	flag.BoolVar(&cfg.RateLimitShared, "rls", false, "keep rate limits in the database to share them between instances")
+	flag.Int64Var(&cfg.MaxBodySize, "mbs", 1<<20, "maximum decompressed request body size in bytes, 0 disables the limit")
+	flag.IntVar(&cfg.MaxBatchSize, "mbi", 1000, "maximum number of items in batch requests, 0 disables the limit")
+	flag.IntVar(&cfg.MaxURLLength, "mul", 2048, "maximum length of shortened URLs in bytes, 0 disables the limit")
+	flag.Func("us", "comma-separated URL schemes allowed for shortening, http and https by default", func(s string) error {
+		cfg.AllowedSchemes = parseStringList(s)
+		return nil
+	})
+	flag.BoolVar(&cfg.NormalizeURLs, "nu", true, "find duplicated URLs by their normalized form")
+	flag.BoolVar(&cfg.NormalizeSortQuery, "nsq", false, "sort query parameters of normalized URLs")
+	flag.BoolVar(&cfg.NormalizeStripTracking, "nst", false, "strip tracking query parameters such as utm_* and fbclid from normalized URLs")
+	flag.Func("ad", "comma-separated domains links may point to, including their subdomains; empty allows any domain", func(s string) error {
+		cfg.AllowedDomains = parseStringList(s)
+		return nil
+	})
+	flag.Func("dd", "comma-separated domains links must not point to, including their subdomains; *.example.com denies only the subdomains", func(s string) error {
+		cfg.DeniedDomains = parseStringList(s)
+		return nil
+	})
+	flag.StringVar(&cfg.BlocklistFile, "bl", "", "file of blocked destinations, one domain or URL pattern like https://example.com/login* per line")
+	flag.DurationVar(&cfg.BlocklistReloadInterval, "bli", 10*time.Second, "how often the blocklist file is checked for changes, 0 disables reloading")
+	flag.Func("co", "comma-separated origins allowed to call the API from browsers, like https://app.example.com or https://*.example.com; empty disables CORS", func(s string) error {
+		cfg.CORSOrigins = parseStringList(s)
+		return nil
+	})
+	flag.Func("cm", "comma-separated methods allowed in cross-origin requests", func(s string) error {
+		cfg.CORSMethods = parseStringList(s)
+		return nil
+	})
+	flag.Func("ch", "comma-separated headers allowed in cross-origin requests", func(s string) error {
+		cfg.CORSHeaders = parseStringList(s)
+		return nil
+	})
+	flag.BoolVar(&cfg.CORSCredentials, "cc", false, "allow cross-origin requests with cookies; requires explicit origins")
+	flag.DurationVar(&cfg.CORSMaxAge, "cma", 10*time.Minute, "how long browsers may cache preflight responses")
+	flag.StringVar(&cfg.TraceExporter, "te", "", "trace exporter: otlp or stdout, empty disables tracing")
+	flag.StringVar(&cfg.TraceEndpoint, "tep", "", "OTLP/HTTP traces endpoint URL, defaults to OTEL_EXPORTER_OTLP_* variables")
+	flag.Float64Var(&cfg.TraceSampleRatio, "tsr", 1, "ratio of sampled root traces")
+	flag.DurationVar(&cfg.HealthCheckTimeout, "hct", 2*time.Second, "readiness checks timeout")
+	flag.DurationVar(&cfg.ShutdownDelay, "sd", 0, "how long to keep serving with failing readiness before shutdown")
+	flag.DurationVar(&cfg.ShutdownTimeout, "st", 10*time.Second, "how long to wait for in-flight requests on shutdown")
+	flag.Func("admins", "comma-separated ids of users allowed to use admin API", func(s string) error {
+		ids, err := parseIntList(s)
+		cfg.AdminUsers = ids
+		return err
+	})
 	flag.Parse()
 
 	return cfg, env.Parse(&cfg)
 }
+
+func parseIntList(s string) ([]int, error) {
+	var res []int
+	for _, item := range parseStringList(s) {
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q: %w", item, err)
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func parseStringList(s string) []string {
+	var res []string
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
@@ -1,5 +1,10 @@
 package errs
 
+import (
+	"fmt"
+	"strings"
+)
+
 // HTTPError represents a domain error that carries an HTTP status code suitable for API responses.
 type HTTPError struct {
 	msg  string
@@ -14,20 +19,20 @@ func NewHTTPError(msg string, code int) *HTTPError {
 	}
 }
 
-// Error is a method that provides public behavior for the corresponding type.
 func (e HTTPError) Error() string {
 	return e.msg
 }
 
-// Code is a method that provides public behavior for the corresponding type.
+// Code returns the HTTP status code to respond with.
 func (e HTTPError) Code() int {
 	return e.code
 }
 
 // DuplicatedURLError reports an attempt to shorten a URL that already exists.
-// Handlers map this error to HTTP 409 Conflict.
+// Index is the position of the URL in a batch. Handlers map this error to HTTP 409 Conflict.
 type DuplicatedURLError struct {
-	url string
+	url   string
+	Index int
 }
 
 // NewDuplicatedURLError creates a DuplicatedURLError for the given URL.
@@ -37,7 +42,37 @@ func NewDuplicatedURLError(url string) *DuplicatedURLError {
 	}
 }
 
-// Error is a method that provides public behavior for the corresponding type.
+// NewDuplicatedItemError creates a DuplicatedURLError for the URL at the given index of a batch.
+func NewDuplicatedItemError(url string, index int) *DuplicatedURLError {
+	return &DuplicatedURLError{
+		url:   url,
+		Index: index,
+	}
+}
+
 func (e DuplicatedURLError) Error() string {
 	return "duplicated URL: " + e.url
 }
+
+// ItemError describes an invalid item of a batch request by its index in the batch.
+type ItemError struct {
+	Index         int    `json:"index"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	Message       string `json:"message"`
+}
+
+// BatchError reports all the invalid items of a batch request.
+// Handlers map this error to Code listing the items, HTTP 400 Bad Request if Code is not set.
+type BatchError struct {
+	Code  int
+	Items []ItemError
+}
+
+// Error lists the messages of all invalid items.
+func (e BatchError) Error() string {
+	msgs := make([]string, 0, len(e.Items))
+	for _, item := range e.Items {
+		msgs = append(msgs, fmt.Sprintf("item %d: %s", item.Index, item.Message))
+	}
+	return strings.Join(msgs, "; ")
+}
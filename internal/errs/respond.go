@@ -0,0 +1,32 @@
+package errs
+
+import (
+	"encoding/json"
+	"github.com/kuznet1/urlshrt/internal/logger"
+	"net/http"
+)
+
+// ErrorResponse is the JSON body of API error responses.
+// RequestID identifies the failed request in the service logs; Items lists the invalid items of a batch request.
+type ErrorResponse struct {
+	Code      int         `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"request_id,omitempty"`
+	Items     []ItemError `json:"items,omitempty"`
+}
+
+// RespondJSON writes an API error response with the given message and status code.
+// The body is an ErrorResponse carrying the id of the request being served.
+func RespondJSON(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	Respond(w, r, ErrorResponse{Code: code, Message: msg})
+}
+
+// Respond writes the API error response with the status code of resp, filling in the request id.
+func Respond(w http.ResponseWriter, r *http.Request, resp ErrorResponse) {
+	resp.RequestID = logger.RequestID(r.Context())
+	data, _ := json.Marshal(resp) // marshaling of strings and ints never fails
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(resp.Code)
+	w.Write(data)
+}
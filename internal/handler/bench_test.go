@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"bytes"
+	"compress/gzip"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -14,6 +16,7 @@ func Benchmark_postRoot(b *testing.B) {
 		b.Fatal(err)
 	}
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://example.com"))
@@ -33,6 +36,7 @@ func Benchmark_getRedirect(b *testing.B) {
 	w := httptest.NewRecorder()
 	mux.ServeHTTP(w, r)
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		r = httptest.NewRequest(http.MethodGet, "/0", nil)
@@ -49,6 +53,7 @@ func Benchmark_postShortenJSON(b *testing.B) {
 	}
 	body := `{"url":"http://foo.bar"}`
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
@@ -65,6 +70,7 @@ func Benchmark_postShortenBatch(b *testing.B) {
 	}
 	body := `[{"correlation_id":"a","original_url":"http://a.b"}]`
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		r := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
@@ -87,6 +93,7 @@ func Benchmark_getUserURLs(b *testing.B) {
 	cookies := res.Cookies()
 	defer res.Body.Close()
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		r = httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
@@ -114,6 +121,7 @@ func Benchmark_deleteUserURLs(b *testing.B) {
 
 	body := `["0"]`
 
+	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		r = httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(body))
@@ -124,3 +132,48 @@ func Benchmark_deleteUserURLs(b *testing.B) {
 		mux.ServeHTTP(w, r)
 	}
 }
+
+// Benchmark 7: POST /api/shorten — compressed response for each supported coding
+func Benchmark_postShortenJSONCompressed(b *testing.B) {
+	for _, encoding := range []string{"gzip", "br", "zstd"} {
+		b.Run(encoding, func(b *testing.B) {
+			mux, err := newMux(b)
+			if err != nil {
+				b.Fatal(err)
+			}
+			body := `{"url":"http://foo.bar"}`
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+				r.Header.Set("Accept-Encoding", encoding)
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// Benchmark 8: POST /api/shorten/batch — gzip-compressed request and response
+func Benchmark_postShortenBatchGzip(b *testing.B) {
+	mux, err := newMux(b)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`[{"correlation_id":"a","original_url":"http://a.b"}]`))
+	gz.Close()
+	body := buf.Bytes()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", bytes.NewReader(body))
+		r.Header.Set("Content-Encoding", "gzip")
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+	}
+}
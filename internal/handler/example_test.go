@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/kuznet1/urlshrt/internal/config"
 	"github.com/kuznet1/urlshrt/internal/middleware"
+	"github.com/kuznet1/urlshrt/internal/model"
 	"github.com/kuznet1/urlshrt/internal/repository"
 	"github.com/kuznet1/urlshrt/internal/service"
 	"go.uber.org/zap"
@@ -94,11 +96,16 @@ func Example_getUserURLs() {
 	w = httptest.NewRecorder()
 	mux.ServeHTTP(w, r)
 
+	// created_at varies between runs, so only the stable fields are printed
+	var items []model.UrlsByUserResponseItem
+	_ = json.NewDecoder(w.Body).Decode(&items)
 	fmt.Println(w.Code)
-	fmt.Println(strings.TrimSpace(w.Body.String()))
+	for _, item := range items {
+		fmt.Println(item.OriginalURL, item.ShortURL, item.Clicks, item.IsDeleted)
+	}
 	// Output:
 	// 200
-	// [{"original_url":"http://example.com","short_url":"http://localhost:8088/0"}]
+	// http://example.com http://localhost:8088/0 0 false
 }
 
 // Example 6: DELETE /api/user/urls — delete user URLs
@@ -6,42 +6,81 @@ import (
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/kuznet1/urlshrt/internal/errs"
+	"github.com/kuznet1/urlshrt/internal/logger"
 	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/kuznet1/urlshrt/internal/qrcode"
 	"github.com/kuznet1/urlshrt/internal/service"
 	"go.uber.org/zap"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// NextCursorHeader carries the cursor of the next page of paginated listings.
+const NextCursorHeader = "X-Next-Cursor"
+
 // Handler wires the HTTP API for the URL shortener.
 // It mounts routes, validates/decodes requests, encodes responses,
 // and translates domain errors into proper HTTP status codes.
 type Handler struct {
-	svc    service.Service
+	svc    *service.Service
 	logger *zap.Logger
+	limits RateLimits
+}
+
+// RateLimits are the middlewares limiting the request rate of the routes creating and visiting short URLs.
+type RateLimits interface {
+	Create(next http.Handler) http.Handler
+	Redirect(next http.Handler) http.Handler
 }
 
 // NewHandler constructs a Handler bound to the given Service and logger.
 // It does not register routes by itself; call Register on the returned handler.
-func NewHandler(svc service.Service, logger *zap.Logger) Handler {
+func NewHandler(svc *service.Service, logger *zap.Logger) Handler {
 	return Handler{svc: svc, logger: logger}
 }
 
-// Register is a method that provides public behavior for the corresponding type.
-func (h Handler) Register(mux *chi.Mux) {
-	mux.Post("/", h.Shorten)
-	mux.Get("/{id}", h.Lengthen)
-	mux.Post("/api/shorten", h.ShortenJSON)
-	mux.Post("/api/shorten/batch", h.ShortenBatch)
+// WithRateLimits returns a copy of the handler registering its routes with the rate limits.
+func (h Handler) WithRateLimits(limits RateLimits) Handler {
+	h.limits = limits
+	return h
+}
+
+// log returns the logger of the request, annotated with its id and user id.
+func (h Handler) log(r *http.Request) *zap.Logger {
+	return logger.FromContext(r.Context(), h.logger)
+}
+
+// Register adds the routes of the handler to mux, applying the rate limits to creation and redirects.
+func (h Handler) Register(mux chi.Router) {
+	create, redirect := mux, mux
+	if h.limits != nil {
+		create, redirect = mux.With(h.limits.Create), mux.With(h.limits.Redirect)
+	}
+
+	create.Post("/", h.Shorten)
+	redirect.Get("/{id}", h.Lengthen)
+	redirect.Get("/{id}/qr", h.QRCode)
+	create.Post("/api/shorten", h.ShortenJSON)
+	create.Post("/api/shorten/batch", h.ShortenBatch)
 	mux.Get("/api/user/urls", h.UserUrls)
 	mux.Delete("/api/user/urls", h.DeleteBatch)
+	mux.Post("/api/user/urls/restore", h.RestoreBatch)
+	mux.Get("/api/user/urls/{id}", h.Link)
+	mux.Patch("/api/user/urls/{id}", h.UpdateLink)
+	mux.Delete("/api/user/urls/{id}", h.DeleteLink)
+	mux.Get("/api/user/operations/{id}", h.Operation)
+	mux.Get("/api/admin/audit", h.AuditLog)
 }
 
-// Shorten is a method that provides public behavior for the corresponding type.
+// Shorten shortens the URL in the plain text body and responds with the short URL.
 func (h Handler) Shorten(w http.ResponseWriter, r *http.Request) {
 	bytes, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to read body: %s", err), http.StatusBadRequest)
+		h.bodyError(w, r, "failed to read body", err)
 		return
 	}
 
@@ -50,7 +89,7 @@ func (h Handler) Shorten(w http.ResponseWriter, r *http.Request) {
 	var duplicatedError *errs.DuplicatedURLError
 	isDuplicatedError := errors.As(err, &duplicatedError)
 	if err != nil && !isDuplicatedError {
-		internalError("failed to shorten url", err, h.logger, w)
+		h.serviceError(w, r, "failed to shorten url", err)
 		return
 	}
 
@@ -63,12 +102,13 @@ func (h Handler) Shorten(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(url))
 }
 
-// ShortenJSON is a method that provides public behavior for the corresponding type.
+// ShortenJSON shortens the URL of a JSON request and responds with the short URL in JSON.
 func (h Handler) ShortenJSON(w http.ResponseWriter, r *http.Request) {
 	var req model.ShortenRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to decode body: %s", err), http.StatusBadRequest)
+		h.bodyError(w, r, "failed to decode body", err)
+		return
 	}
 
 	url, err := h.svc.Shorten(r.Context(), req.URL)
@@ -79,22 +119,23 @@ func (h Handler) ShortenJSON(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		var duplicatedError *errs.DuplicatedURLError
 		if errors.As(err, &duplicatedError) {
-			respJSON(w, resp, http.StatusConflict, h.logger)
+			h.respJSON(w, r, resp, http.StatusConflict)
 		} else {
-			internalError("failed to shorten url", err, h.logger, w)
+			h.serviceError(w, r, "failed to shorten url", err)
 		}
 		return
 	}
 
-	respJSON(w, resp, http.StatusCreated, h.logger)
+	h.respJSON(w, r, resp, http.StatusCreated)
 }
 
-// ShortenBatch is a method that provides public behavior for the corresponding type.
+// ShortenBatch shortens a batch of URLs, responding with the short URLs by correlation id.
 func (h Handler) ShortenBatch(w http.ResponseWriter, r *http.Request) {
 	var req []model.BatchShortenRequestItem
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to decode body: %s", err), http.StatusBadRequest)
+		h.bodyError(w, r, "failed to decode body", err)
+		return
 	}
 
 	var urls []string
@@ -103,14 +144,31 @@ func (h Handler) ShortenBatch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	shortenLinks, err := h.svc.BatchShorten(r.Context(), urls)
+	var batchError *errs.BatchError
+	if errors.As(err, &batchError) {
+		for i := range batchError.Items {
+			batchError.Items[i].CorrelationID = req[batchError.Items[i].Index].CorrelationID
+		}
+		code, msg := http.StatusBadRequest, "%d of %d urls are invalid"
+		if batchError.Code == http.StatusForbidden {
+			code, msg = http.StatusForbidden, "%d of %d urls are blocked"
+		}
+		errs.Respond(w, r, errs.ErrorResponse{
+			Code:    code,
+			Message: fmt.Sprintf(msg, len(batchError.Items), len(urls)),
+			Items:   batchError.Items,
+		})
+		return
+	}
+
 	var duplicatedError *errs.DuplicatedURLError
 	if errors.As(err, &duplicatedError) {
-		http.Error(w, err.Error(), http.StatusConflict)
+		h.error(w, r, err.Error(), http.StatusConflict)
 		return
 	}
 
 	if err != nil {
-		internalError("failed to shorten urls", err, h.logger, w)
+		h.serviceError(w, r, "failed to shorten urls", err)
 		return
 	}
 
@@ -122,30 +180,113 @@ func (h Handler) ShortenBatch(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	respJSON(w, resp, http.StatusCreated, h.logger)
+	h.respJSON(w, r, resp, http.StatusCreated)
 }
 
-// DeleteBatch is a method that provides public behavior for the corresponding type.
+// DeleteBatch queues the deletion of the links of the user listed in a JSON array of ids.
+// It responds with 202 Accepted and the id of the operation reporting the outcomes.
 func (h Handler) DeleteBatch(w http.ResponseWriter, r *http.Request) {
 	var req []string
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to decode body: %s", err), http.StatusBadRequest)
+		h.bodyError(w, r, "failed to decode body", err)
+		return
+	}
+
+	operationID, err := h.svc.BatchDelete(r.Context(), req)
+	if err != nil {
+		h.serviceError(w, r, "failed to delete urls", err)
+		return
+	}
+
+	h.operationAccepted(w, r, operationID)
+}
+
+// RestoreBatch queues the restoration of the deleted links of the user listed in a JSON array of ids.
+func (h Handler) RestoreBatch(w http.ResponseWriter, r *http.Request) {
+	var req []string
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.bodyError(w, r, "failed to decode body", err)
+		return
+	}
+
+	operationID, err := h.svc.BatchRestore(r.Context(), req)
+	if err != nil {
+		h.serviceError(w, r, "failed to restore urls", err)
+		return
+	}
+
+	h.operationAccepted(w, r, operationID)
+}
+
+// operationAccepted responds with 202 Accepted, pointing to the status of the queued operation.
+func (h Handler) operationAccepted(w http.ResponseWriter, r *http.Request, operationID string) {
+	w.Header().Set("Location", "/api/user/operations/"+operationID)
+	h.respJSON(w, r, model.OperationAcceptedResponse{OperationID: operationID}, http.StatusAccepted)
+}
+
+// Operation returns the outcomes of a deletion or restore operation of the user.
+func (h Handler) Operation(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.svc.Operation(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.serviceError(w, r, "failed to get operation", err)
+		return
+	}
+
+	h.respJSON(w, r, resp, http.StatusOK)
+}
+
+// Link returns the details and the edit history of a link of the user.
+func (h Handler) Link(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.svc.Link(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.serviceError(w, r, "failed to get url", err)
+		return
+	}
+
+	h.respJSON(w, r, resp, http.StatusOK)
+}
+
+// UpdateLink changes the destination URL or the title of a link of the user.
+// It responds with 409 Conflict if the new URL is already shortened.
+func (h Handler) UpdateLink(w http.ResponseWriter, r *http.Request) {
+	var req model.UpdateLinkRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		h.bodyError(w, r, "failed to decode body", err)
+		return
+	}
+
+	resp, err := h.svc.UpdateLink(r.Context(), chi.URLParam(r, "id"), model.LinkUpdate{URL: req.URL, Title: req.Title, Interstitial: req.Interstitial})
+	var duplicatedError *errs.DuplicatedURLError
+	if errors.As(err, &duplicatedError) {
+		h.error(w, r, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.serviceError(w, r, "failed to update url", err)
+		return
 	}
 
-	err = h.svc.BatchDelete(r.Context(), req)
+	h.respJSON(w, r, resp, http.StatusOK)
+}
+
+// DeleteLink deletes a link of the user immediately.
+func (h Handler) DeleteLink(w http.ResponseWriter, r *http.Request) {
+	err := h.svc.DeleteLink(r.Context(), chi.URLParam(r, "id"))
 	if err != nil {
-		internalError("failed to shorten urls", err, h.logger, w)
+		h.serviceError(w, r, "failed to delete url", err)
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func respJSON(w http.ResponseWriter, resp any, code int, logger *zap.Logger) {
+func (h Handler) respJSON(w http.ResponseWriter, r *http.Request, resp any, code int) {
 	data, err := json.Marshal(resp)
 	if err != nil {
-		internalError("failed to encode response", err, logger, w)
+		h.internalError(w, r, "failed to encode response", err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -153,42 +294,225 @@ func respJSON(w http.ResponseWriter, resp any, code int, logger *zap.Logger) {
 	w.Write(data)
 }
 
-// Lengthen is a method that provides public behavior for the corresponding type.
+// Lengthen redirects to the destination of the link or shows its preview page,
+// see parseVisit for the kinds of visits.
 func (h Handler) Lengthen(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
+	id, visit, confirmToken := parseVisit(r, chi.URLParam(r, "id"))
 
-	url, err := h.svc.Lengthen(r.Context(), id)
-	var httpErr *errs.HTTPError
-	if errors.As(err, &httpErr) {
-		http.Error(w, httpErr.Error(), httpErr.Code())
+	dest, err := h.svc.Lengthen(r.Context(), id, visit, confirmToken)
+	if err != nil {
+		h.serviceError(w, r, "failed to lengthen url", err)
 		return
 	}
-	if err != nil {
-		internalError("failed to lengthen url", err, h.logger, w)
+	if dest.Preview {
+		h.preview(w, r, dest)
 		return
 	}
 
-	w.Header().Set("Location", url)
+	w.Header().Set("Location", dest.URL)
 	w.WriteHeader(http.StatusTemporaryRedirect)
 }
 
-// UserUrls is a method that provides public behavior for the corresponding type.
+// QRCode responds with the QR code image of the short link.
+// The format, size, level and margin query parameters override qrcode.DefaultOptions.
+func (h Handler) QRCode(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseQROptions(r.URL.Query())
+	if err != nil {
+		h.error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	img, err := h.svc.QRCode(r.Context(), chi.URLParam(r, "id"), opts)
+	if err != nil {
+		h.serviceError(w, r, "failed to render qr code", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", opts.Format.ContentType())
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(img)
+}
+
+func parseQROptions(values url.Values) (qrcode.Options, error) {
+	opts := qrcode.DefaultOptions
+	if format := values.Get("format"); format != "" {
+		opts.Format = qrcode.Format(strings.ToLower(format))
+	}
+	if level := values.Get("level"); level != "" {
+		opts.Level = strings.ToUpper(level)
+	}
+
+	if v := values.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid size %q", v)
+		}
+		opts.Size = size
+	}
+	if v := values.Get("margin"); v != "" {
+		margin, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid margin %q", v)
+		}
+		opts.Margin = margin
+	}
+	return opts, nil
+}
+
+// UserUrls returns a page of the user's links. The limit, cursor, sort (created or clicks),
+// order (asc or desc) and search query parameters select the page; the cursor of the next page
+// is returned in the X-Next-Cursor header.
 func (h Handler) UserUrls(w http.ResponseWriter, r *http.Request) {
-	urls, err := h.svc.UserUrls(r.Context())
+	q, err := parseLinkQuery(r.URL.Query())
+	if err != nil {
+		h.error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	urls, next, err := h.svc.UserUrls(r.Context(), q)
 	if err != nil {
-		internalError("failed to get urls", err, h.logger, w)
+		h.serviceError(w, r, "failed to get urls", err)
 		return
 	}
 
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
+
 	status := http.StatusOK
 	if len(urls) == 0 {
 		status = http.StatusNoContent
 	}
 
-	respJSON(w, urls, status, h.logger)
+	h.respJSON(w, r, urls, status)
+}
+
+func parseLinkQuery(values url.Values) (model.LinkQuery, error) {
+	q := model.LinkQuery{
+		Search: values.Get("search"),
+		Sort:   model.LinkSort(values.Get("sort")),
+		Cursor: values.Get("cursor"),
+	}
+
+	switch q.Sort {
+	case "", model.LinkSortCreated, model.LinkSortClicks:
+	default:
+		return q, fmt.Errorf("invalid sort %q: must be %q or %q", q.Sort, model.LinkSortCreated, model.LinkSortClicks)
+	}
+
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("invalid order %q: must be asc or desc", order)
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return q, fmt.Errorf("invalid limit %q", v)
+		}
+		q.Limit = limit
+	}
+
+	return q, nil
 }
 
-func internalError(msg string, err error, logger *zap.Logger, w http.ResponseWriter) {
-	logger.Error(msg, zap.Error(err))
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+// AuditLog returns audit events filtered by user_id, action, url substring and
+// the [from, to) RFC 3339 time range, paginated with limit and cursor query parameters.
+// It is available to admin users only.
+func (h Handler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	q, err := parseAuditQuery(r.URL.Query())
+	if err != nil {
+		h.error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.svc.QueryAudit(r.Context(), q)
+	if err != nil {
+		h.serviceError(w, r, "failed to query audit log", err)
+		return
+	}
+
+	h.respJSON(w, r, page, http.StatusOK)
+}
+
+func parseAuditQuery(values url.Values) (model.AuditQuery, error) {
+	q := model.AuditQuery{
+		Action: model.AuditAction(values.Get("action")),
+		URL:    values.Get("url"),
+		Cursor: values.Get("cursor"),
+	}
+
+	if v := values.Get("user_id"); v != "" {
+		userID, err := strconv.Atoi(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid user_id %q", v)
+		}
+		q.UserID = &userID
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return q, fmt.Errorf("invalid limit %q", v)
+		}
+		q.Limit = limit
+	}
+
+	for _, bound := range []struct {
+		name string
+		dst  *int64
+	}{{"from", &q.From}, {"to", &q.To}} {
+		v := values.Get(bound.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid %s %q: RFC 3339 time expected", bound.name, v)
+		}
+		*bound.dst = t.Unix()
+	}
+
+	return q, nil
+}
+
+// serviceError responds with the status code of an HTTPError returned by the service, and 500 to other errors.
+func (h Handler) serviceError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	var httpErr *errs.HTTPError
+	if errors.As(err, &httpErr) {
+		h.error(w, r, httpErr.Error(), httpErr.Code())
+		return
+	}
+	h.internalError(w, r, msg, err)
+}
+
+// bodyError responds to a failure to read or decode the request body,
+// with 413 if the body exceeds the size limit and 400 otherwise.
+func (h Handler) bodyError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		h.error(w, r, fmt.Sprintf("request body is too large, the limit is %d bytes", maxBytesErr.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	h.error(w, r, fmt.Sprintf("%s: %s", msg, err), http.StatusBadRequest)
+}
+
+func (h Handler) internalError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	h.log(r).Error(msg, zap.Error(err))
+	h.error(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// error responds with a JSON ErrorResponse body on API routes and a plain text body otherwise,
+// so the redirect endpoints keep their original behavior.
+func (h Handler) error(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		errs.RespondJSON(w, r, msg, code)
+		return
+	}
+	http.Error(w, msg, code)
 }
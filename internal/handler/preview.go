@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"bytes"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// previewTemplate is the interstitial page showing the destination of a short link.
+// The continue button follows the link with a signed confirm token, which redirects even for links forcing the preview.
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+<title>Link preview</title>
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 4em auto; padding: 0 1em; color: #222; }
+.url { word-break: break-all; font-family: monospace; background: #f4f4f4; padding: .5em; }
+.continue { display: inline-block; margin-top: 1em; padding: .6em 1.2em; background: #2563eb; color: #fff; text-decoration: none; border-radius: 4px; }
+</style>
+</head>
+<body>
+<h1>This short link leads to</h1>
+{{with .Title}}<p><strong>{{.}}</strong></p>{{end}}
+<p class="url">{{.URL}}</p>
+<p>Short link {{.ShortURL}} was created on <time datetime="{{.CreatedAt.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.UTC.Format "January 2, 2006"}}</time>.</p>
+<p>Make sure you trust the destination before continuing.</p>
+<a class="continue" href="{{.ContinueURL}}" rel="noreferrer noopener">Continue</a>
+</body>
+</html>
+`))
+
+// parseVisit returns the id of the link visited by GET /{id}, the kind of the visit and its confirm token:
+// a trailing "+" or ?preview=1 asks for the preview page, ?confirm=<token> continues from it.
+func parseVisit(r *http.Request, id string) (string, model.Visit, string) {
+	id, preview := strings.CutSuffix(id, "+")
+	query := r.URL.Query()
+	switch {
+	case query.Get("confirm") != "":
+		return id, model.VisitConfirmed, query.Get("confirm")
+	case preview || query.Get("preview") == "1":
+		return id, model.VisitPreview, ""
+	}
+	return id, model.VisitFollow, ""
+}
+
+// preview renders the interstitial page of the link.
+func (h Handler) preview(w http.ResponseWriter, r *http.Request, dest model.Destination) {
+	var buf bytes.Buffer
+	err := previewTemplate.Execute(&buf, dest)
+	if err != nil {
+		h.internalError(w, r, "failed to render preview", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,30 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileWritable returns a check that the file at path can be written,
+// or created if it does not exist yet.
+func FileWritable(path string) Check {
+	return func(ctx context.Context) error {
+		file, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err == nil {
+			return file.Close()
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("file %s is not writable: %w", path, err)
+		}
+
+		file, err = os.CreateTemp(filepath.Dir(path), ".healthcheck-*")
+		if err != nil {
+			return fmt.Errorf("directory of %s is not writable: %w", path, err)
+		}
+		file.Close()
+		return os.Remove(file.Name())
+	}
+}
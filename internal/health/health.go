@@ -0,0 +1,116 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Component statuses reported by the readiness endpoint.
+const (
+	StatusOK           = "ok"
+	StatusFail         = "fail"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check reports whether a dependency is usable.
+type Check func(ctx context.Context) error
+
+// ComponentStatus is the state of a single component in the readiness report.
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the JSON body of the health endpoints.
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker serves the liveness and readiness endpoints.
+// Readiness runs the registered component checks and fails once shutdown has begun.
+type Checker struct {
+	checks       []namedCheck
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a Checker limiting every readiness check to timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a component check reported under name. It must not be called while serving.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name, check})
+}
+
+// ShutDown makes the readiness endpoint fail, so load balancers stop routing requests to the instance.
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Livez reports that the process is running and able to serve requests.
+func (c *Checker) Livez(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Readyz runs all component checks concurrently and responds with 503 if any of them fails
+// or the service is shutting down.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := c.run(r.Context())
+	code := http.StatusOK
+	if report.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	respond(w, code, report)
+}
+
+func (c *Checker) run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Components: make(map[string]ComponentStatus, len(c.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := ComponentStatus{Status: StatusOK}
+			if err := nc.check(ctx); err != nil {
+				status = ComponentStatus{Status: StatusFail, Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[nc.name] = status
+			if status.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.shuttingDown.Load() {
+		report.Status = StatusShuttingDown
+	}
+	return report
+}
+
+func respond(w http.ResponseWriter, code int, report Report) {
+	data, _ := json.Marshal(report) // marshaling of strings never fails
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(data)
+}
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, handler http.HandlerFunc) (int, Report) {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func TestChecker(t *testing.T) {
+	storageErr := errors.New("connection refused")
+	var failing bool
+	c := NewChecker(time.Second)
+	c.Add("storage", func(ctx context.Context) error {
+		if failing {
+			return storageErr
+		}
+		return nil
+	})
+	c.Add("slow", func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok, "checks are limited by the timeout")
+		return nil
+	})
+
+	code, report := get(t, c.Readyz)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, Report{Status: StatusOK, Components: map[string]ComponentStatus{
+		"storage": {Status: StatusOK},
+		"slow":    {Status: StatusOK},
+	}}, report)
+
+	failing = true
+	code, report = get(t, c.Readyz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Equal(t, ComponentStatus{Status: StatusFail, Error: "connection refused"}, report.Components["storage"])
+
+	failing = false
+	c.ShutDown()
+	code, report = get(t, c.Readyz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusShuttingDown, report.Status)
+
+	code, report = get(t, c.Livez)
+	assert.Equal(t, http.StatusOK, code, "liveness does not depend on readiness")
+	assert.Equal(t, StatusOK, report.Status)
+}
+
+func TestFileWritable(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "store.json")
+	assert.NoError(t, FileWritable(fname)(context.Background()), "missing file in a writable directory")
+
+	require.NoError(t, os.WriteFile(fname, nil, 0644))
+	assert.NoError(t, FileWritable(fname)(context.Background()))
+
+	assert.Error(t, FileWritable(filepath.Join(dir, "missing", "store.json"))(context.Background()))
+}
@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"context"
+	"go.uber.org/zap"
+)
+
+type key int
+
+const (
+	loggerKey key = iota
+	requestIDKey
+	accessKey
+)
+
+// Access collects request attributes discovered by inner middlewares and handlers
+// that are reported in the access log line.
+type Access struct {
+	UserID    int
+	HasUserID bool
+}
+
+// WithRequest returns a context carrying the request id, a logger annotated with it
+// and an Access record to be filled while the request is served.
+func WithRequest(ctx context.Context, base *zap.Logger, requestID string) (context.Context, *Access) {
+	access := &Access{}
+	ctx = context.WithValue(ctx, requestIDKey, requestID)
+	ctx = context.WithValue(ctx, accessKey, access)
+	ctx = context.WithValue(ctx, loggerKey, base.With(zap.String("request_id", requestID)))
+	return ctx, access
+}
+
+// WithUserID annotates the request logger with the authenticated user id and records it for the access log.
+func WithUserID(ctx context.Context, userID int) context.Context {
+	if access, ok := ctx.Value(accessKey).(*Access); ok {
+		access.UserID = userID
+		access.HasUserID = true
+	}
+	if l, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		ctx = context.WithValue(ctx, loggerKey, l.With(zap.Int("user_id", userID)))
+	}
+	return ctx
+}
+
+// RequestID returns the id of the request being served, or an empty string outside of a request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// FromContext returns the request-scoped logger, or fallback if the context has none.
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if l, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return l
+	}
+	return fallback
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/logger"
 	"github.com/kuznet1/urlshrt/internal/repository"
 	"go.uber.org/zap"
 	"net/http"
@@ -13,17 +14,23 @@ import (
 // CookieName is the name of the cookie that carries the JWT with the user identity.
 var CookieName = "token"
 
+// UserCreator registers new users. It is implemented by both the repository and the service;
+// the latter also publishes a user creation audit event.
+type UserCreator interface {
+	CreateUser(ctx context.Context) (int, error)
+}
+
 // Auth issues and validates per-user JWT cookies and stores the user id in the request context.
-// If an incoming request has no valid cookie, a new user is created via the repository and a token is set.
+// If an incoming request has no valid cookie, a new user is created via the UserCreator and a token is set.
 type Auth struct {
-	repo   repository.Repo
+	users  UserCreator
 	cfg    config.Config
 	logger *zap.Logger
 }
 
-// NewAuth creates the authentication middleware using the provided config, repository and logger.
-func NewAuth(repo repository.Repo, cfg config.Config, logger *zap.Logger) *Auth {
-	return &Auth{repo: repo, cfg: cfg, logger: logger}
+// NewAuth creates the authentication middleware using the provided config, user creator and logger.
+func NewAuth(users UserCreator, cfg config.Config, logger *zap.Logger) *Auth {
+	return &Auth{users: users, cfg: cfg, logger: logger}
 }
 
 // Claims contains the JWT payload used by the authentication middleware.
@@ -39,7 +46,7 @@ func (auth *Auth) Authentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie(CookieName)
 		if err != nil && err != http.ErrNoCookie {
-			auth.internalError("unable to get cookie", err, w)
+			auth.internalError(r, "unable to get cookie", err, w)
 			return
 		}
 
@@ -48,39 +55,48 @@ func (auth *Auth) Authentication(next http.Handler) http.Handler {
 		if err == nil {
 			claims, err := auth.parseToken(cookie.Value)
 			if err != nil {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				respondError(w, r, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 				return
 			}
 			userID = claims.UserID
 		}
 
 		if err == http.ErrNoCookie {
-			userID, err = auth.repo.CreateUser(r.Context())
+			userID, err = auth.users.CreateUser(r.Context())
 			if err != nil {
-				auth.internalError("unable to create user", err, w)
+				auth.internalError(r, "unable to create user", err, w)
+				return
 			}
 
 			token, err := auth.createToken(Claims{UserID: userID})
 			if err != nil {
-				auth.internalError("unable to create token", err, w)
+				auth.internalError(r, "unable to create token", err, w)
+				return
 			}
 
-			http.SetCookie(w, &http.Cookie{
+			cookie := &http.Cookie{
 				Name:     CookieName,
 				Value:    token,
 				Path:     "/",
 				HttpOnly: true,
-			})
+			}
+			if auth.cfg.CORSCredentials {
+				// browsers send cookies with cross-origin requests only if they are marked so
+				cookie.SameSite = http.SameSiteNoneMode
+				cookie.Secure = true
+			}
+			http.SetCookie(w, cookie)
 		}
 
 		ctx := context.WithValue(r.Context(), repository.UserIDKey, userID)
+		ctx = logger.WithUserID(ctx, userID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (auth *Auth) internalError(msg string, err error, w http.ResponseWriter) {
-	auth.logger.Error(msg, zap.Error(err))
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+func (auth *Auth) internalError(r *http.Request, msg string, err error, w http.ResponseWriter) {
+	logger.FromContext(r.Context(), auth.logger).Error(msg, zap.Error(err))
+	respondError(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
 func (auth *Auth) parseToken(tokenString string) (*Claims, error) {
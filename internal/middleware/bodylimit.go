@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"github.com/kuznet1/urlshrt/internal/config"
+	"net/http"
+)
+
+// BodyLimiter is an HTTP middleware limiting the size of request bodies.
+// It must be installed after Compression, so the limit applies to decompressed bodies
+// and compressed payloads expanding to huge sizes are cut off while being read.
+type BodyLimiter struct {
+	limit int64
+}
+
+// NewBodyLimiter creates the middleware limiting bodies to cfg.MaxBodySize bytes; 0 disables the limit.
+func NewBodyLimiter(cfg config.Config) BodyLimiter {
+	return BodyLimiter{limit: cfg.MaxBodySize}
+}
+
+// BodyLimit makes reads of the request body fail with *http.MaxBytesError once the limit is exceeded.
+func (l BodyLimiter) BodyLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.limit > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, l.limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/kuznet1/urlshrt/internal/pool"
+	"io"
+)
+
+// supportedResponseEncodings lists supported response codings in order of server preference.
+var supportedResponseEncodings = []string{"zstd", "br", "gzip"}
+
+// resettableWriter is a compressing writer that can be reused for another destination.
+type resettableWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// pooledWriter adapts resettableWriter to pool.Resettable.
+type pooledWriter struct {
+	w resettableWriter
+}
+
+// Reset detaches the writer from the previous destination.
+func (p *pooledWriter) Reset() {
+	p.w.Reset(io.Discard)
+}
+
+// resettableReader is a decompressing reader that can be reused for another source.
+type resettableReader interface {
+	io.Reader
+	Reset(r io.Reader) error
+}
+
+// pooledReader adapts resettableReader to pool.Resettable.
+type pooledReader struct {
+	r resettableReader
+}
+
+// Reset detaches the reader from the previous source.
+func (p *pooledReader) Reset() {
+	// there is nothing to decode, so the error about the missing header is expected
+	_ = p.r.Reset(eofReader{})
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+// codecs keeps pools of encoders and decoders, so they are not allocated on every request.
+type codecs struct {
+	writers map[string]*pool.Pool[*pooledWriter]
+	readers map[string]*pool.Pool[*pooledReader]
+}
+
+// newCodecs creates encoder pools with the given compression level on the gzip scale 1-9,
+// which is mapped to the brotli and zstd scales; 0 and -1 select the default level of each coding.
+// The zstd decoders refuse frames declaring a window larger than maxBodySize, as the window
+// is allocated before any decoded byte is counted against the body limit; 0 keeps the zstd defaults.
+func newCodecs(level int, maxBodySize int64) (*codecs, error) {
+	if level < gzip.DefaultCompression || level > gzip.BestCompression {
+		return nil, fmt.Errorf("invalid compression level %d: must be between 1 and 9, or 0 for default", level)
+	}
+
+	gzipLevel, brotliLevel, zstdLevel := gzip.DefaultCompression, brotli.DefaultCompression, zstd.SpeedDefault
+	if level > 0 {
+		gzipLevel, brotliLevel, zstdLevel = level, level, zstd.EncoderLevelFromZstd(level)
+	}
+
+	zstdOptions := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if maxBodySize > 0 {
+		limit := uint64(max(maxBodySize, zstd.MinWindowSize))
+		zstdOptions = append(zstdOptions, zstd.WithDecoderMaxWindow(limit), zstd.WithDecoderMaxMemory(limit))
+	}
+
+	gzipReaders := pool.NewPool(func() *pooledReader {
+		return &pooledReader{new(gzip.Reader)}
+	})
+
+	return &codecs{
+		writers: map[string]*pool.Pool[*pooledWriter]{
+			"gzip": pool.NewPool(func() *pooledWriter {
+				w, _ := gzip.NewWriterLevel(nil, gzipLevel) // the level is validated above
+				return &pooledWriter{w}
+			}),
+			"br": pool.NewPool(func() *pooledWriter {
+				return &pooledWriter{brotli.NewWriterLevel(nil, brotliLevel)}
+			}),
+			"zstd": pool.NewPool(func() *pooledWriter {
+				w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstdLevel)) // fails on invalid options only
+				return &pooledWriter{w}
+			}),
+		},
+		readers: map[string]*pool.Pool[*pooledReader]{
+			"gzip":   gzipReaders,
+			"x-gzip": gzipReaders,
+			"zstd": pool.NewPool(func() *pooledReader {
+				r, _ := zstd.NewReader(nil, zstdOptions...) // fails on invalid options only
+				return &pooledReader{r}
+			}),
+			"br": pool.NewPool(func() *pooledReader {
+				return &pooledReader{brotli.NewReader(nil)}
+			}),
+		},
+	}, nil
+}
+
+// newWriter takes an encoder of the given coding writing to w; release returns it to the pool after Close.
+func (c *codecs) newWriter(encoding string, w io.Writer) (*pooledWriter, func(*pooledWriter)) {
+	p := c.writers[encoding]
+	res := p.Get()
+	res.w.Reset(w)
+	return res, p.Put
+}
+
+// newReader returns a reader decoding r with the given coding and a function releasing its resources.
+func (c *codecs) newReader(coding string, r io.Reader) (io.Reader, func(), error) {
+	if coding == "deflate" {
+		res, err := newDeflateReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return res, func() { res.Close() }, nil
+	}
+
+	p, ok := c.readers[coding]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w %q", errUnsupportedEncoding, coding)
+	}
+
+	res := p.Get()
+	err := res.r.Reset(r)
+	if err != nil {
+		p.Put(res)
+		return nil, nil, err
+	}
+	return res.r, func() { p.Put(res) }, nil
+}
+
+// newDeflateReader decodes the "deflate" coding, which is zlib-wrapped deflate by the spec,
+// but some clients send raw deflate streams, so the zlib header is checked first.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
@@ -1,13 +1,20 @@
 package middleware
 
 import (
-	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/config"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
-var compressingEnableEncodings = []string{
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// defaultCompressTypes are media types compressed when no list is configured.
+var defaultCompressTypes = []string{
 	"application/json",
 	"text/html",
 }
@@ -15,96 +22,228 @@ var compressingEnableEncodings = []string{
 type compressedWriter struct {
 	httpWriter http.ResponseWriter
 	writer     io.Writer
+	encoder    *pooledWriter
+	release    func(*pooledWriter)
 	status     int
+	encoding   string
+	compressor *Compressor
+	// buf holds the beginning of a compressible response until it reaches the minimum size
+	buf     []byte
+	decided bool
 }
 
-func newCompressedWriter(httpWriter http.ResponseWriter) *compressedWriter {
+func newCompressedWriter(httpWriter http.ResponseWriter, encoding string, compressor *Compressor) *compressedWriter {
 	return &compressedWriter{
 		httpWriter: httpWriter,
 		status:     http.StatusOK,
+		encoding:   encoding,
+		compressor: compressor,
 	}
 }
 
-// Header is a method that provides public behavior for the corresponding type.
 func (c *compressedWriter) Header() http.Header {
 	return c.httpWriter.Header()
 }
 
-// WriteHeader is a method that provides public behavior for the corresponding type.
+// WriteHeader defers the status until it is known whether the response is compressed.
 func (c *compressedWriter) WriteHeader(statusCode int) {
 	c.status = statusCode
 	// headers will be written later
 }
 
-// Write is a method that provides public behavior for the corresponding type.
+// Write buffers the response until it reaches the minimum size to compress, then compresses it.
 func (c *compressedWriter) Write(p []byte) (int, error) {
-	c.initWriter()
-	return c.writer.Write(p)
-}
-
-func (c *compressedWriter) initWriter() {
 	if c.writer != nil {
-		return
+		return c.writer.Write(p)
 	}
 
-	defer c.httpWriter.WriteHeader(c.status)
+	if !c.decided {
+		c.decided = true
+		if !c.compressor.compressible(c.Header()) {
+			c.writer = c.httpWriter
+			c.httpWriter.WriteHeader(c.status)
+			return c.writer.Write(p)
+		}
+	}
 
-	contentEncoding := c.Header().Get("Content-Type")
-	enableCompression := false
-	for _, compressingEnableEncoding := range compressingEnableEncodings {
-		enableCompression = enableCompression || contentEncoding == compressingEnableEncoding
+	c.buf = append(c.buf, p...)
+	if len(c.buf) < c.compressor.minSize {
+		return len(p), nil
 	}
 
-	if !enableCompression {
-		c.writer = c.httpWriter
-		return
+	err := c.startCompression()
+	if err != nil {
+		return 0, err
 	}
+	return len(p), nil
+}
 
-	c.Header().Set("Content-Encoding", "gzip")
-	c.writer = gzip.NewWriter(c.httpWriter)
+// startCompression commits to a compressed response and flushes the buffered data through the encoder.
+func (c *compressedWriter) startCompression() error {
+	c.Header().Set("Content-Encoding", c.encoding)
+	c.Header().Del("Content-Length")
+	c.httpWriter.WriteHeader(c.status)
+
+	c.encoder, c.release = c.compressor.codecs.newWriter(c.encoding, c.httpWriter)
+	c.writer = c.encoder.w
+	_, err := c.writer.Write(c.buf)
+	c.buf = nil
+	return err
 }
 
-// Close is a method that provides public behavior for the corresponding type.
+// Close writes a response too small to compress as is, or flushes the encoder.
 func (c *compressedWriter) Close() error {
 	if c.writer == nil {
+		// the response is empty or too small to be compressed
+		if len(c.buf) == 0 {
+			c.httpWriter.WriteHeader(c.status)
+			return nil
+		}
+		c.Header().Set("Content-Length", strconv.Itoa(len(c.buf)))
 		c.httpWriter.WriteHeader(c.status)
+		_, err := c.httpWriter.Write(c.buf)
+		return err
+	}
+
+	if c.encoder == nil {
 		return nil
 	}
 
-	if closer, ok := c.writer.(io.Closer); ok {
-		return closer.Close()
+	err := c.encoder.w.Close()
+	c.release(c.encoder)
+	c.encoder = nil
+	return err
+}
+
+// decodeBody replaces the request body with a decoding reader according to Content-Encoding.
+// Multiple codings are undone in reverse order of application.
+// The returned function releases the decoders once the body is no longer used.
+func (cmp *Compressor) decodeBody(r *http.Request) (func(), error) {
+	var releases []func()
+	release := func() {
+		for _, f := range releases {
+			f()
+		}
 	}
 
-	return nil
+	header := r.Header.Get("Content-Encoding")
+	if header == "" {
+		return release, nil
+	}
+
+	codings := strings.Split(header, ",")
+	var body io.Reader = r.Body
+	for i := len(codings) - 1; i >= 0; i-- {
+		coding := strings.ToLower(strings.TrimSpace(codings[i]))
+		if coding == identity {
+			continue
+		}
+		reader, releaseReader, err := cmp.codecs.newReader(coding, body)
+		if errors.Is(err, errUnsupportedEncoding) {
+			release()
+			return nil, err
+		}
+		if err != nil {
+			release()
+			return nil, fmt.Errorf("failed to decompress request body: %w", err)
+		}
+		releases = append(releases, releaseReader)
+		body = reader
+	}
+
+	r.Body = io.NopCloser(body)
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return release, nil
 }
 
-// Compression performs a public package operation. Top-level handler/function.
-func Compression(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+// Compressor is an HTTP middleware that decodes compressed request bodies and
+// compresses responses of the configured media types once they reach the minimum size.
+type Compressor struct {
+	minSize int
+	types   []string
+	codecs  *codecs
+}
 
-		if r.Header.Get("Content-Encoding") == "gzip" {
-			gz, err := gzip.NewReader(r.Body)
-			if err != nil {
-				http.Error(w, "failed to decompress request body", http.StatusBadRequest)
-				return
-			}
-			r.Body = gz
-			r.Header.Del("Content-Encoding")
+// NewCompressor creates the compression middleware using cfg.CompressMinSize, cfg.CompressTypes,
+// cfg.CompressLevel and cfg.MaxBodySize. Encoders and decoders are pooled and reused across requests.
+func NewCompressor(cfg config.Config) (*Compressor, error) {
+	types := cfg.CompressTypes
+	if len(types) == 0 {
+		types = defaultCompressTypes
+	}
+
+	codecs, err := newCodecs(cfg.CompressLevel, cfg.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Compressor{minSize: cfg.CompressMinSize, types: types, codecs: codecs}, nil
+}
+
+// defaultCompressor is valid as the zero config selects the default compression level.
+var defaultCompressor, _ = NewCompressor(config.Config{})
+
+// compressible reports whether a response with the given headers may be compressed.
+func (cmp *Compressor) compressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	for _, pattern := range cmp.types {
+		if matchMediaType(pattern, mediaType) {
+			return true
 		}
+	}
+	return false
+}
+
+// matchMediaType matches a media type against a pattern such as "application/json", "text/*" or "*/*".
+func matchMediaType(pattern, mediaType string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	prefix, ok := strings.CutSuffix(pattern, "/*")
+	return ok && strings.HasPrefix(mediaType, prefix+"/")
+}
 
-		acceptEncodings := strings.Split(r.Header.Get("Accept-Encoding"), ",")
-		supportsGzip := false
-		for _, acceptEncoding := range acceptEncodings {
-			supportsGzip = supportsGzip || strings.HasPrefix(strings.TrimSpace(acceptEncoding), "gzip")
+// Compression decodes gzip, deflate, zstd and br request bodies and compresses
+// responses with the best coding acceptable by the client according to Accept-Encoding.
+func (cmp *Compressor) Compression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := cmp.decodeBody(r)
+		if errors.Is(err, errUnsupportedEncoding) {
+			respondError(w, r, err.Error(), http.StatusUnsupportedMediaType)
+			return
 		}
+		if err != nil {
+			respondError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer release()
 
-		if !supportsGzip {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), supportedResponseEncodings)
+		if encoding == identity {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		cw := newCompressedWriter(w)
+		cw := newCompressedWriter(w, encoding, cmp)
 		defer cw.Close()
 		next.ServeHTTP(cw, r)
 	})
 }
+
+// Compression applies the compression middleware with the default settings:
+// JSON and HTML responses of any size are compressed.
+func Compression(next http.Handler) http.Handler {
+	return defaultCompressor.Compression(next)
+}
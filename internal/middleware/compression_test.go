@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompressorThresholdAndTypes(t *testing.T) {
+	cmp, err := NewCompressor(config.Config{CompressMinSize: 100, CompressTypes: []string{"application/json", "text/*"}})
+	require.NoError(t, err)
+	tests := []struct {
+		name        string
+		contentType string
+		chunks      []string
+		compressed  bool
+	}{
+		{"json with charset", "application/json; charset=utf-8", []string{strings.Repeat("a", 150)}, true},
+		{"below threshold", "application/json", []string{`{"result":"http://localhost/0"}`}, false},
+		{"threshold reached by chunks", "application/json", []string{strings.Repeat("a", 60), strings.Repeat("b", 60)}, true},
+		{"wildcard", "text/plain; charset=utf-8", []string{strings.Repeat("a", 150)}, true},
+		{"not matching type", "image/png", []string{strings.Repeat("a", 150)}, false},
+		{"invalid type", "application/json;;", []string{strings.Repeat("a", 150)}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := cmp.Compression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				w.WriteHeader(http.StatusCreated)
+				for _, chunk := range test.chunks {
+					w.Write([]byte(chunk))
+				}
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			res := w.Result()
+			defer res.Body.Close()
+
+			require.Equal(t, http.StatusCreated, res.StatusCode)
+			want := strings.Join(test.chunks, "")
+			body := io.Reader(res.Body)
+			if test.compressed {
+				require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+				assert.Empty(t, res.Header.Get("Content-Length"))
+				gz, err := gzip.NewReader(res.Body)
+				require.NoError(t, err)
+				body = gz
+			} else {
+				require.Empty(t, res.Header.Get("Content-Encoding"))
+				if test.contentType == "application/json" {
+					assert.Equal(t, strconv.Itoa(len(want)), res.Header.Get("Content-Length"))
+				}
+			}
+
+			data, err := io.ReadAll(body)
+			require.NoError(t, err)
+			assert.Equal(t, want, string(data))
+		})
+	}
+}
+
+func TestCompressorLevel(t *testing.T) {
+	_, err := NewCompressor(config.Config{CompressLevel: 10})
+	assert.Error(t, err)
+
+	_, err = NewCompressor(config.Config{CompressLevel: gzip.BestSpeed})
+	assert.NoError(t, err)
+}
+
+func TestCompressorZstdWindowLimit(t *testing.T) {
+	cmp, err := NewCompressor(config.Config{MaxBodySize: 4096})
+	require.NoError(t, err)
+	handler := cmp.Compression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Write(body)
+	}))
+	send := func(body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		r.Header.Set("Content-Encoding", "zstd")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	var buf bytes.Buffer
+	enc, err := zstd.NewWriter(&buf)
+	require.NoError(t, err)
+	enc.Write([]byte(strings.Repeat("a", 2000)))
+	require.NoError(t, enc.Close())
+	w := send(buf.Bytes())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2000, w.Body.Len())
+
+	// a frame of a single raw byte declaring a 128 MiB window: magic, header without content size,
+	// window descriptor with exponent 17, and the header of the last raw block of 1 byte
+	frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 17 << 3, 0x09, 0x00, 0x00, 'x'}
+	var header zstd.Header
+	require.NoError(t, header.Decode(frame))
+	require.Equal(t, uint64(128<<20), header.WindowSize)
+
+	w = send(frame)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "window size exceeded")
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultCORSMethods are methods allowed in cross-origin requests when no list is configured.
+var defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete}
+
+// defaultCORSHeaders are request headers allowed in cross-origin requests when no list is configured.
+var defaultCORSHeaders = []string{"Content-Type", "Content-Encoding", RequestIDHeader}
+
+// corsExposedHeaders are response headers readable by cross-origin scripts.
+var corsExposedHeaders = []string{RequestIDHeader, "Retry-After", "Location", "X-Next-Cursor"}
+
+// CORS is an HTTP middleware that allows browser front-ends on other origins to call the API.
+// It must be installed before Authentication, so preflight requests do not create users.
+type CORS struct {
+	origins     []string
+	methods     []string
+	headers     []string
+	credentials bool
+	maxAge      string
+}
+
+// NewCORS creates the CORS middleware using cfg.CORSOrigins, cfg.CORSMethods, cfg.CORSHeaders,
+// cfg.CORSCredentials and cfg.CORSMaxAge. Without allowed origins the middleware does nothing.
+// Allowing any origin with credentials is rejected, as it would let every site act on behalf of the user.
+func NewCORS(cfg config.Config) (*CORS, error) {
+	if cfg.CORSCredentials && slices.Contains(cfg.CORSOrigins, "*") {
+		return nil, errors.New("cors: credentials cannot be allowed for any origin, list the allowed origins explicitly")
+	}
+
+	methods := defaultCORSMethods
+	if len(cfg.CORSMethods) > 0 {
+		methods = nil
+		for _, method := range cfg.CORSMethods {
+			methods = append(methods, strings.ToUpper(method))
+		}
+	}
+	headers := cfg.CORSHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+
+	return &CORS{
+		origins:     cfg.CORSOrigins,
+		methods:     methods,
+		headers:     headers,
+		credentials: cfg.CORSCredentials,
+		maxAge:      strconv.Itoa(int(cfg.CORSMaxAge.Seconds())),
+	}, nil
+}
+
+// allowedOrigin reports whether requests from the origin are allowed.
+func (c *CORS) allowedOrigin(origin string) bool {
+	return slices.ContainsFunc(c.origins, func(pattern string) bool {
+		return matchOrigin(pattern, origin)
+	})
+}
+
+// matchOrigin matches an origin against a pattern such as "https://app.example.com",
+// "https://*.example.com" or "*". The wildcard matches a non-empty part of the host.
+func matchOrigin(pattern, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+	if pattern == "*" || pattern == origin {
+		return true
+	}
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	return ok && len(origin) > len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+}
+
+// allowOriginValue returns the Access-Control-Allow-Origin value for an allowed origin.
+func (c *CORS) allowOriginValue(origin string) string {
+	if slices.Contains(c.origins, "*") {
+		return "*"
+	}
+	return origin
+}
+
+// CrossOrigin answers preflight requests from allowed origins and adds CORS headers to actual requests.
+// Requests from other origins are served without CORS headers, so browsers block their responses.
+func (c *CORS) CrossOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(c.origins) == 0 || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			method := r.Header.Get("Access-Control-Request-Method")
+			if c.allowedOrigin(origin) && slices.Contains(c.methods, method) {
+				c.setOriginHeaders(header, origin)
+				header.Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+				header.Set("Access-Control-Allow-Headers", strings.Join(c.headers, ", "))
+				header.Set("Access-Control-Max-Age", c.maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if c.allowedOrigin(origin) {
+			c.setOriginHeaders(header, origin)
+			header.Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CORS) setOriginHeaders(header http.Header, origin string) {
+	header.Set("Access-Control-Allow-Origin", c.allowOriginValue(origin))
+	if c.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCrossOrigin(t *testing.T) {
+	cfg := config.Config{
+		CORSOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+		CORSCredentials: true,
+		CORSMaxAge:      time.Hour,
+	}
+	cors, err := NewCORS(cfg)
+	require.NoError(t, err)
+	mux := chi.NewRouter()
+	mux.Use(cors.CrossOrigin)
+	mux.Post("/api/shorten", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	do := func(method, origin, requestMethod string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/api/shorten", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if requestMethod != "" {
+			r.Header.Set("Access-Control-Request-Method", requestMethod)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		w := do(http.MethodOptions, "https://app.example.com", http.MethodPost)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "GET, POST, PATCH, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Content-Type, Content-Encoding, X-Request-ID", w.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "3600", w.Header().Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("preflight for a disallowed method", func(t *testing.T) {
+		w := do(http.MethodOptions, "https://app.example.com", http.MethodPut)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("wildcard origin", func(t *testing.T) {
+		w := do(http.MethodPost, "https://dash.example.org", "")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "https://dash.example.org", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "X-Request-ID")
+		assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+	})
+
+	t.Run("disallowed origin", func(t *testing.T) {
+		w := do(http.MethodPost, "https://evil.com", "")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("same origin", func(t *testing.T) {
+		w := do(http.MethodPost, "", "")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Values("Vary"))
+	})
+}
+
+func TestAnyOriginWithCredentials(t *testing.T) {
+	_, err := NewCORS(config.Config{CORSOrigins: []string{"https://app.example.com", "*"}, CORSCredentials: true})
+	assert.ErrorContains(t, err, "credentials cannot be allowed for any origin")
+
+	cors, err := NewCORS(config.Config{CORSOrigins: []string{"*"}})
+	require.NoError(t, err)
+	mux := chi.NewRouter()
+	mux.Use(cors.CrossOrigin)
+	mux.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"*", "https://a.com", true},
+		{"https://a.com", "HTTPS://A.COM", true},
+		{"https://*.a.com", "https://x.a.com", true},
+		{"https://*.a.com", "https://.a.com", false},
+		{"https://*.a.com", "https://a.com", false},
+		{"https://*.a.com", "http://x.a.com", false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, matchOrigin(test.pattern, test.origin), "%s vs %s", test.pattern, test.origin)
+	}
+}
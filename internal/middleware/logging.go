@@ -1,18 +1,26 @@
 package middleware
 
 import (
+	"github.com/go-chi/chi/v5"
+	"github.com/kuznet1/urlshrt/internal/logger"
+	"github.com/kuznet1/urlshrt/internal/random"
+	"go.uber.org/zap"
+	"net"
 	"net/http"
 	"time"
-
-	"go.uber.org/zap"
 )
 
-// RequestLogger is a public struct of the package. It exposes the core data for this project.
+// RequestIDHeader carries the request id in requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLen = 128
+
+// RequestLogger logs every request with its duration, status and response size.
 type RequestLogger struct {
 	logger *zap.Logger
 }
 
-// NewRequestLogger performs a public package operation. Top-level handler/function.
+// NewRequestLogger creates a RequestLogger writing to logger.
 func NewRequestLogger(logger *zap.Logger) RequestLogger {
 	return RequestLogger{logger: logger}
 }
@@ -23,34 +31,83 @@ type wrappedWriter struct {
 	len    int
 }
 
-// WriteHeader is a method that provides public behavior for the corresponding type.
+// WriteHeader remembers the first status written.
 func (w *wrappedWriter) WriteHeader(status int) {
 	w.ResponseWriter.WriteHeader(status)
-	w.status = status
+	if w.status == 0 {
+		w.status = status
+	}
 }
 
-// Write is a method that provides public behavior for the corresponding type.
+// Write counts the bytes written; a write without a status implies 200 OK.
 func (w *wrappedWriter) Write(b []byte) (len int, err error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
 	len, err = w.ResponseWriter.Write(b)
 	w.len += len
 	return
 }
 
-// Logging is a method that provides public behavior for the corresponding type.
+// Logging assigns the request an id, taken from the X-Request-ID header when valid,
+// echoes it in the response, puts a logger annotated with it into the request context,
+// and writes a single access log line once the request is served.
 func (l RequestLogger) Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = random.ID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		ctx, access := logger.WithRequest(r.Context(), l.logger, requestID)
+
 		writer := &wrappedWriter{w, 0, 0}
 		start := time.Now()
-		next.ServeHTTP(writer, r)
+		next.ServeHTTP(writer, r.WithContext(ctx))
 		elapsed := time.Since(start)
-		l.logger.Info("request:",
-			zap.String("uri", r.RequestURI),
+
+		if writer.status == 0 {
+			writer.status = http.StatusOK
+		}
+
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+
+		fields := []zap.Field{
+			zap.String("request_id", requestID),
 			zap.String("method", r.Method),
-			zap.Duration("time", elapsed),
-		)
-		l.logger.Info("response:",
+			zap.String("uri", r.RequestURI),
+			zap.String("route", route),
 			zap.Int("status", writer.status),
 			zap.Int("size", writer.len),
-		)
+			zap.Duration("duration", elapsed),
+			zap.String("remote_ip", remoteIP(r)),
+		}
+		if access.HasUserID {
+			fields = append(fields, zap.Int("user_id", access.UserID))
+		}
+		l.logger.Info("access", fields...)
 	})
 }
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/kuznet1/urlshrt/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoggingAccessLine(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	mux := chi.NewRouter()
+	mux.Use(NewRequestLogger(zap.New(core)).Logging)
+	mux.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := logger.WithUserID(r.Context(), 7)
+		logger.FromContext(ctx, zap.NewNop()).Info("handled")
+		w.Write([]byte("hello"))
+	})
+
+	tests := []struct {
+		name      string
+		requestID string
+		generated bool
+	}{
+		{"accepted", "abc-123", false},
+		{"generated", "", true},
+		{"invalid replaced", "bad id", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.TakeAll()
+			req := httptest.NewRequest(http.MethodGet, "/42", nil)
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			requestID := rec.Header().Get(RequestIDHeader)
+			if tt.generated {
+				assert.Len(t, requestID, 32)
+			} else {
+				assert.Equal(t, tt.requestID, requestID)
+			}
+
+			entries := logs.AllUntimed()
+			require.Len(t, entries, 2)
+			handled, access := entries[0].ContextMap(), entries[1].ContextMap()
+			assert.Equal(t, requestID, handled["request_id"])
+			assert.EqualValues(t, 7, handled["user_id"])
+
+			assert.Equal(t, "access", entries[1].Message)
+			assert.Equal(t, requestID, access["request_id"])
+			assert.EqualValues(t, http.StatusOK, access["status"])
+			assert.EqualValues(t, 5, access["size"])
+			assert.EqualValues(t, 7, access["user_id"])
+			assert.Equal(t, "/{id}", access["route"])
+			assert.Equal(t, "192.0.2.1", access["remote_ip"])
+		})
+	}
+}
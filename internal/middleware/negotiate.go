@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+)
+
+const identity = "identity"
+
+// parseQualities parses an Accept-Encoding header value into coding names and their q-values.
+// Coding names are lowercased; tokens with malformed q-values are ignored.
+func parseQualities(header string) map[string]float64 {
+	res := make(map[string]float64)
+	for _, token := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(token, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(param, "=")
+			if !ok || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				q = -1
+				break
+			}
+			q = parsed
+		}
+		if q < 0 {
+			continue
+		}
+
+		if name == "x-gzip" {
+			name = "gzip"
+		}
+		res[name] = q
+	}
+	return res
+}
+
+// negotiateEncoding picks the response content coding for the Accept-Encoding header value
+// among the supported codings listed in order of server preference.
+// It returns identity when no supported coding is acceptable, the header is absent,
+// or identity is listed with a higher q-value. Ties are resolved by server preference.
+func negotiateEncoding(header string, supported []string) string {
+	if strings.TrimSpace(header) == "" {
+		return identity
+	}
+
+	qualities := parseQualities(header)
+	star, hasStar := qualities["*"]
+	quality := func(name string) float64 {
+		if q, ok := qualities[name]; ok {
+			return q
+		}
+		if hasStar {
+			return star
+		}
+		return 0
+	}
+
+	best, bestQ := identity, 0.0
+	for _, name := range supported {
+		if q := quality(name); q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+
+	if identityQ, ok := qualities[identity]; ok && identityQ > bestQ {
+		return identity
+	}
+	return best
+}
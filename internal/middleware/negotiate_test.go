@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	supported := []string{"zstd", "br", "gzip"}
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", identity},
+		{"gzip", "gzip"},
+		{"GZIP", "gzip"},
+		{"x-gzip", "gzip"},
+		{"gzip;q=0", identity},
+		{"gzip-foo", identity},
+		{"gzip, br", "br"},
+		{"gzip;q=1, br;q=0.5", "gzip"},
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"*", "zstd"},
+		{"*;q=0.5, zstd;q=0", "br"},
+		{"identity;q=1, gzip;q=0.5", identity},
+		{"gzip;q=0.5, identity;q=0.5", "gzip"},
+		{"deflate", identity},
+		{"gzip;q=abc, br", "br"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			assert.Equal(t, test.want, negotiateEncoding(test.header, supported))
+		})
+	}
+}
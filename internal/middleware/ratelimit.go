@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/logger"
+	"github.com/kuznet1/urlshrt/internal/ratelimit"
+	"github.com/kuznet1/urlshrt/internal/repository"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimiter provides HTTP middlewares limiting the request rate of every client separately
+// for URL creation and for redirects, which include link previews and QR codes.
+// They are attached to the limited routes where they are registered and must run after Authentication.
+type RateLimiter struct {
+	limiter  ratelimit.Limiter
+	create   ratelimit.Limit
+	redirect ratelimit.Limit
+	logger   *zap.Logger
+}
+
+// NewRateLimiter creates the rate limiting middlewares with the limits from cfg.RateLimitCreate,
+// cfg.RateLimitRedirect and their bursts, storing buckets in the given limiter.
+func NewRateLimiter(limiter ratelimit.Limiter, cfg config.Config, logger *zap.Logger) *RateLimiter {
+	return &RateLimiter{
+		limiter:  limiter,
+		create:   ratelimit.NewLimit(cfg.RateLimitCreate, cfg.RateLimitCreateBurst),
+		redirect: ratelimit.NewLimit(cfg.RateLimitRedirect, cfg.RateLimitRedirectBurst),
+		logger:   logger,
+	}
+}
+
+// Create limits the routes creating short URLs.
+func (rl *RateLimiter) Create(next http.Handler) http.Handler {
+	return rl.limit("create", rl.create, next)
+}
+
+// Redirect limits the routes visiting short URLs.
+func (rl *RateLimiter) Redirect(next http.Handler) http.Handler {
+	return rl.limit("redirect", rl.redirect, next)
+}
+
+// clientKeys returns the buckets charged for the request: the bucket of the user if the request carries a token,
+// and the bucket of the IP address. As tokens are issued to anyone, clients minting new ones still share
+// the limit of their address, while users switching addresses keep their own limit.
+func clientKeys(r *http.Request) []string {
+	keys := make([]string, 0, 2)
+	if _, err := r.Cookie(CookieName); err == nil {
+		if userID, err := repository.GetUserID(r.Context()); err == nil {
+			keys = append(keys, "user:"+strconv.Itoa(userID))
+		}
+	}
+	return append(keys, "ip:"+remoteIP(r))
+}
+
+// allow takes a token from every bucket of the client, stopping at the first empty one.
+func (rl *RateLimiter) allow(r *http.Request, group string, limit ratelimit.Limit) (bool, time.Duration, error) {
+	for _, key := range clientKeys(r) {
+		allowed, retryAfter, err := rl.limiter.Allow(r.Context(), group+":"+key, limit)
+		if err != nil || !allowed {
+			return allowed, retryAfter, err
+		}
+	}
+	return true, 0, nil
+}
+
+// limit rejects requests exceeding the limit of the route group with 429 Too Many Requests
+// and a Retry-After header. Requests are let through if the limiter fails.
+func (rl *RateLimiter) limit(group string, limit ratelimit.Limit, next http.Handler) http.Handler {
+	if !limit.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, retryAfter, err := rl.allow(r, group, limit)
+		if err != nil {
+			logger.FromContext(r.Context(), rl.logger).Error("rate limiter failure", zap.Error(err))
+			next.ServeHTTP(w, r)
+			return
+		}
+		if allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		seconds := max(1, int(math.Ceil(retryAfter.Seconds())))
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		respondError(w, r, fmt.Sprintf("rate limit exceeded, retry in %d s", seconds), http.StatusTooManyRequests)
+	})
+}
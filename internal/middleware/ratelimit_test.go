@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"github.com/go-chi/chi/v5"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/ratelimit"
+	"github.com/kuznet1/urlshrt/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type limiterCall struct {
+	key   string
+	limit ratelimit.Limit
+}
+
+// fakeLimiter allows the first n calls per key and records the calls.
+type fakeLimiter struct {
+	n     int
+	calls []limiterCall
+	count map[string]int
+}
+
+func (f *fakeLimiter) Allow(_ context.Context, key string, limit ratelimit.Limit) (bool, time.Duration, error) {
+	f.calls = append(f.calls, limiterCall{key, limit})
+	f.count[key]++
+	return f.count[key] <= f.n, 1500 * time.Millisecond, nil
+}
+
+func TestRateLimit(t *testing.T) {
+	limiter := &fakeLimiter{n: 1, count: map[string]int{}}
+	cfg := config.Config{RateLimitCreate: 1, RateLimitRedirect: 10, RateLimitRedirectBurst: 20}
+	rl := NewRateLimiter(limiter, cfg, zap.NewNop())
+	mux := chi.NewRouter()
+	mux.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c, err := r.Cookie(CookieName); err == nil {
+				userID, _ := strconv.Atoi(c.Value)
+				r = r.WithContext(context.WithValue(r.Context(), repository.UserIDKey, userID))
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	mux.With(rl.Create).Post("/api/shorten", ok)
+	mux.With(rl.Redirect).Get("/{id}", ok)
+	mux.With(rl.Redirect).Get("/{id}/qr", ok)
+	mux.Get("/api/user/urls", ok)
+
+	// do sends the request from the address with the token of the user, or without a token if user is empty
+	do := func(method, target, user, addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		r.RemoteAddr = addr + ":1234"
+		if user != "" {
+			r.AddCookie(&http.Cookie{Name: CookieName, Value: user})
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/shorten", "5", "192.0.2.1").Code)
+	w := do(http.MethodPost, "/api/shorten", "5", "192.0.2.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":429`)
+
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/api/shorten", "6", "192.0.2.1").Code, "new tokens share the limit of the address")
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/api/shorten", "5", "192.0.2.2").Code, "users keep their limit on other addresses")
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/shorten", "", "192.0.2.3").Code, "clients without a token are limited by address")
+
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/abc", "5", "192.0.2.1").Code, "redirects are limited separately")
+	w = do(http.MethodGet, "/abc", "5", "192.0.2.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/abc/qr", "5", "192.0.2.1").Code, "qr codes share the redirect limit")
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/urls", "5", "192.0.2.1").Code, "other routes are not limited")
+	}
+
+	create, redirect := ratelimit.Limit{Rate: 1, Burst: 1}, ratelimit.Limit{Rate: 10, Burst: 20}
+	assert.Equal(t, []limiterCall{
+		{"create:user:5", create},
+		{"create:ip:192.0.2.1", create},
+		{"create:user:5", create},
+		{"create:user:6", create},
+		{"create:ip:192.0.2.1", create},
+		{"create:user:5", create},
+		{"create:ip:192.0.2.3", create},
+		{"redirect:user:5", redirect},
+		{"redirect:ip:192.0.2.1", redirect},
+		{"redirect:user:5", redirect},
+		{"redirect:user:5", redirect},
+	}, limiter.calls)
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	limiter := &fakeLimiter{count: map[string]int{}}
+	rl := NewRateLimiter(limiter, config.Config{}, zap.NewNop())
+	mux := chi.NewRouter()
+	mux.With(rl.Create).Post("/api/shorten", func(w http.ResponseWriter, r *http.Request) {})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/shorten", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, limiter.calls)
+}
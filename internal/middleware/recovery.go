@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"expvar"
+	"github.com/kuznet1/urlshrt/internal/errs"
+	"github.com/kuznet1/urlshrt/internal/logger"
+	"go.uber.org/zap"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// panicsRecovered counts handler panics turned into 500 responses; it is exposed at /debug/vars.
+var panicsRecovered = expvar.NewInt("http_panics_recovered_total")
+
+// Recoverer is an HTTP middleware that turns handler panics into 500 responses.
+type Recoverer struct {
+	logger *zap.Logger
+}
+
+// NewRecoverer creates the recovery middleware logging panics to the given logger.
+func NewRecoverer(logger *zap.Logger) Recoverer {
+	return Recoverer{logger: logger}
+}
+
+// Recovery recovers from panics in the next handlers, logs the panic value and the stack
+// with the request id and responds with a JSON error body unless the response has already started.
+// A panic with http.ErrAbortHandler aborts the response deliberately, so it is neither logged nor answered.
+// It must be installed right after Logging and Tracing, so it covers all other middlewares.
+func (rec Recoverer) Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writer := &wrappedWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil || p == http.ErrAbortHandler {
+				return
+			}
+
+			panicsRecovered.Add(1)
+			logger.FromContext(r.Context(), rec.logger).Error("panic recovered",
+				zap.Any("panic", p),
+				zap.ByteString("stack", debug.Stack()),
+				zap.Bool("response_started", writer.status != 0),
+			)
+			if writer.status != 0 {
+				// the status is sent and the body may be partly sent, so the error cannot be reported
+				return
+			}
+			errs.RespondJSON(w, r, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// respondError responds with a JSON ErrorResponse body on API routes and a plain text body otherwise,
+// like the handlers do.
+func respondError(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		errs.RespondJSON(w, r, msg, code)
+		return
+	}
+	http.Error(w, msg, code)
+}
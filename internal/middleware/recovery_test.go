@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/kuznet1/urlshrt/internal/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	log := zap.New(core)
+	mux := chi.NewRouter()
+	mux.Use(NewRequestLogger(log).Logging, NewRecoverer(log).Recovery)
+	mux.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	before := panicsRecovered.Value()
+	r := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	r.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var body errs.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, errs.ErrorResponse{Code: 500, Message: "Internal Server Error", RequestID: "req-1"}, body)
+	assert.Equal(t, before+1, panicsRecovered.Value())
+
+	entries := logs.FilterMessage("panic recovered").AllUntimed()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "req-1", fields["request_id"])
+	assert.Equal(t, "boom", fields["panic"])
+	assert.Contains(t, fields["stack"], "recovery_test.go")
+
+	access := logs.FilterMessage("access").AllUntimed()
+	require.Len(t, access, 1)
+	assert.EqualValues(t, http.StatusInternalServerError, access[0].ContextMap()["status"])
+}
+
+func TestRecoveryAfterResponseStarted(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	log := zap.New(core)
+	mux := chi.NewRouter()
+	mux.Use(NewRequestLogger(log).Logging, NewRecoverer(log).Recovery)
+	mux.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "partial", w.Body.String(), "nothing is appended to the started response")
+	entries := logs.FilterMessage("panic recovered").AllUntimed()
+	require.Len(t, entries, 1)
+	assert.Equal(t, true, entries[0].ContextMap()["response_started"])
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 // ShortenRequest is the JSON payload for POST /api/shorten.
 // URL must contain the original absolute URL to shorten.
 type ShortenRequest struct {
@@ -28,6 +30,68 @@ type BatchShortenResponseItem struct {
 
 // UrlsByUserResponseItem represents an item in the response of GET /api/user/urls.
 type UrlsByUserResponseItem struct {
-	OriginalURL string `json:"original_url"`
-	ShortURL    string `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	ShortURL    string     `json:"short_url"`
+	Title       string     `json:"title"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Clicks      int64      `json:"clicks"`
+	IsDeleted   bool       `json:"is_deleted"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+// UpdateLinkRequest is the JSON payload for PATCH /api/user/urls/{id}.
+// Omitted fields are left unchanged.
+type UpdateLinkRequest struct {
+	URL          *string `json:"url"`
+	Title        *string `json:"title"`
+	Interstitial *bool   `json:"interstitial"`
+}
+
+// LinkResponse is the JSON response of GET and PATCH /api/user/urls/{id}.
+// History lists the edits of the link from the oldest to the newest.
+type LinkResponse struct {
+	OriginalURL  string     `json:"original_url"`
+	ShortURL     string     `json:"short_url"`
+	Title        string     `json:"title"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Clicks       int64      `json:"clicks"`
+	IsDeleted    bool       `json:"is_deleted"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	Interstitial bool       `json:"interstitial"`
+	History      []LinkEdit `json:"history"`
+}
+
+// Destination is the target of a visited short link.
+// Preview is set if the visit shows the interstitial page instead of redirecting to the URL;
+// ContinueURL is then the link of its continue button.
+type Destination struct {
+	ShortURL    string
+	URL         string
+	Title       string
+	CreatedAt   time.Time
+	Preview     bool
+	ContinueURL string
+}
+
+// OperationAcceptedResponse is the JSON response of DELETE /api/user/urls and POST /api/user/urls/restore.
+// The operation status is available at GET /api/user/operations/{operation_id}.
+type OperationAcceptedResponse struct {
+	OperationID string `json:"operation_id"`
+}
+
+// OperationResponse is the JSON response of GET /api/user/operations/{id}.
+// Kind is "delete" or "restore"; Status is "pending" until all the items are processed and "done" after.
+type OperationResponse struct {
+	ID        string                  `json:"id"`
+	Kind      string                  `json:"kind"`
+	Status    string                  `json:"status"`
+	CreatedAt time.Time               `json:"created_at"`
+	Items     []OperationResponseItem `json:"items"`
+}
+
+// OperationResponseItem is the outcome of a single link of an operation, "pending" until it is processed.
+type OperationResponseItem struct {
+	ID       string `json:"id"`
+	ShortURL string `json:"short_url"`
+	Outcome  string `json:"outcome"`
 }
@@ -8,10 +8,57 @@ const ActionShorten AuditAction = "shorten"
 // ActionFollow is a public package constant used for configuration or external access.
 const ActionFollow AuditAction = "follow"
 
-// AuditEvent is a public struct of the package. It exposes the core data for this project.
+// ActionBatchShorten is fired once per URL stored by a batch shorten request.
+const ActionBatchShorten AuditAction = "batch_shorten"
+
+// ActionDeleteRequested is fired for every short URL a user asks to delete.
+const ActionDeleteRequested AuditAction = "delete_requested"
+
+// ActionDeleteApplied is fired by the deletion worker once a deletion request is processed.
+// The event outcome tells whether the link was actually deleted.
+const ActionDeleteApplied AuditAction = "delete_applied"
+
+// ActionRestoreRequested is fired for every deleted short URL a user asks to restore.
+const ActionRestoreRequested AuditAction = "restore_requested"
+
+// ActionRestoreApplied is fired by the deletion worker once a restore request is processed.
+// The event outcome tells whether the link was actually restored.
+const ActionRestoreApplied AuditAction = "restore_applied"
+
+// ActionEdit is fired when a user changes the destination URL or the metadata of a link.
+const ActionEdit AuditAction = "edit"
+
+// ActionBlocked is fired when a URL forbidden by the destination policy is shortened or followed.
+// The outcome of the event holds the reason.
+const ActionBlocked AuditAction = "blocked"
+
+// ActionUserCreated is fired when a new user is registered by the authentication middleware.
+const ActionUserCreated AuditAction = "user_created"
+
+// AuditEvent records an action of a user on a URL at the unix time TS.
 type AuditEvent struct {
-	TS     int64       `json:"ts"`
-	Action AuditAction `json:"action"`
-	UserID int         `json:"user_id"`
-	URL    string      `json:"url"`
+	TS      int64       `json:"ts"`
+	Action  AuditAction `json:"action"`
+	UserID  int         `json:"user_id"`
+	URL     string      `json:"url"`
+	Outcome string      `json:"outcome,omitempty"`
+}
+
+// AuditQuery filters audit events returned by the admin audit API.
+// Zero values disable the corresponding filter. Events are returned from the newest to the oldest.
+type AuditQuery struct {
+	UserID *int
+	Action AuditAction
+	URL    string
+	From   int64
+	To     int64
+	Cursor string
+	Limit  int
+}
+
+// AuditPage is the JSON response of GET /api/admin/audit.
+// NextCursor is empty when there are no more events.
+type AuditPage struct {
+	Events     []AuditEvent `json:"events"`
+	NextCursor string       `json:"next_cursor,omitempty"`
 }
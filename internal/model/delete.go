@@ -0,0 +1,31 @@
+package model
+
+// DeleteOutcome describes what happened to a single deletion or restore request.
+type DeleteOutcome string
+
+const (
+	// DeleteOutcomeDeleted means the link was marked as deleted.
+	DeleteOutcomeDeleted DeleteOutcome = "deleted"
+	// DeleteOutcomeNotFound means there is no link with the requested id.
+	DeleteOutcomeNotFound DeleteOutcome = "not_found"
+	// DeleteOutcomeNotOwned means the link belongs to another user.
+	DeleteOutcomeNotOwned DeleteOutcome = "not_owned"
+	// DeleteOutcomeFailed means the storage returned an error while deleting or restoring.
+	DeleteOutcomeFailed DeleteOutcome = "failed"
+	// DeleteOutcomeRestored means the deleted link was restored.
+	DeleteOutcomeRestored DeleteOutcome = "restored"
+	// DeleteOutcomeNotDeleted means a restore was requested for a link that is not deleted.
+	DeleteOutcomeNotDeleted DeleteOutcome = "not_deleted"
+	// DeleteOutcomeExpired means the link was deleted too long ago to be restored.
+	DeleteOutcomeExpired DeleteOutcome = "expired"
+)
+
+// DeleteResult is the outcome of a deletion or restore request processed by the deletion worker.
+// OperationID is empty for deletions requested outside of an operation.
+type DeleteResult struct {
+	UserID      int
+	URLID       URLID
+	Restore     bool
+	OperationID string
+	Outcome     DeleteOutcome
+}
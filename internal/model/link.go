@@ -0,0 +1,79 @@
+package model
+
+import "time"
+
+// LinkSort is the order of links returned by GET /api/user/urls.
+type LinkSort string
+
+// Supported link orders.
+const (
+	LinkSortCreated LinkSort = "created"
+	LinkSortClicks  LinkSort = "clicks"
+)
+
+// Link is a stored short link with its statistics.
+// Interstitial forces the preview page for every visit of the link.
+type Link struct {
+	ID           URLID
+	URL          string
+	Title        string
+	UserID       int
+	CreatedAt    time.Time
+	Clicks       int64
+	IsDeleted    bool
+	DeletedAt    *time.Time
+	Interstitial bool
+}
+
+// Visit is the kind of a visit of a short link.
+type Visit int
+
+// Supported visits: following the link, previewing it with GET /{id}+ or ?preview=1,
+// and continuing from the preview page with the signed short-lived token of its continue link.
+const (
+	VisitFollow Visit = iota
+	VisitPreview
+	VisitConfirmed
+)
+
+// Redirects reports whether the visit goes to the destination rather than the preview page.
+// Only redirecting visits are counted as clicks.
+func (v Visit) Redirects(interstitial bool) bool {
+	return v == VisitConfirmed || v == VisitFollow && !interstitial
+}
+
+// LinkQuery selects a page of the user's links.
+// Search filters links by a substring of the original URL; Desc reverses the order;
+// Cursor continues the listing after the last link of the previous page.
+type LinkQuery struct {
+	Search string
+	Sort   LinkSort
+	Desc   bool
+	Cursor string
+	Limit  int
+}
+
+// LinkTarget is a URL to shorten along with its normalized form, which identifies duplicated URLs.
+// Redirects use the URL as given.
+type LinkTarget struct {
+	URL        string
+	Normalized string
+}
+
+// LinkUpdate lists the changes of a link; nil fields are left unchanged.
+// NormalizedURL is the normalized form of URL, set by the service.
+type LinkUpdate struct {
+	URL           *string
+	NormalizedURL string
+	Title         *string
+	Interstitial  *bool
+}
+
+// LinkEdit is an entry of the edit history of a link, holding its values before and after the edit.
+type LinkEdit struct {
+	EditedAt time.Time `json:"edited_at"`
+	OldURL   string    `json:"old_url"`
+	NewURL   string    `json:"new_url"`
+	OldTitle string    `json:"old_title"`
+	NewTitle string    `json:"new_title"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Operation is a batch of deletion or restore requests queued by a single API call.
+type Operation struct {
+	ID        string
+	UserID    int
+	Restore   bool
+	CreatedAt time.Time
+	Items     []OperationItem
+}
+
+// OperationItem is a link of an operation. Outcome is empty until the deletion worker processes the item.
+type OperationItem struct {
+	URLID   URLID
+	Outcome DeleteOutcome
+}
+
+// Done reports whether all the items of the operation are processed.
+func (op Operation) Done() bool {
+	for _, item := range op.Items {
+		if item.Outcome == "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+// Package qrcode renders QR codes as PNG and SVG images.
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"rsc.io/qr"
+	"slices"
+	"strings"
+)
+
+// Format is the image format of a rendered QR code.
+type Format string
+
+// Supported formats.
+const (
+	FormatPNG Format = "png"
+	FormatSVG Format = "svg"
+)
+
+// ContentType returns the media type of images in the format.
+func (f Format) ContentType() string {
+	if f == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Levels are the names of the error correction levels, from the least to the most tolerant of errors.
+var Levels = []string{"L", "M", "Q", "H"}
+
+// Options control the rendering of a QR code.
+// Size is the width and the height of the image in pixels and Margin is the width of the quiet zone in modules.
+// Modules are scaled by a whole number of pixels and the code is centered in the image.
+type Options struct {
+	Format Format
+	Size   int
+	Level  string
+	Margin int
+}
+
+// DefaultOptions render a 256 pixels PNG with error correction level M and the standard 4 modules margin.
+var DefaultOptions = Options{Format: FormatPNG, Size: 256, Level: "M", Margin: 4}
+
+// Encode renders the text as a QR code image.
+// It fails if the level is unknown or the code with its margin does not fit into the image size.
+func Encode(text string, opts Options) ([]byte, error) {
+	level := slices.Index(Levels, opts.Level)
+	if level < 0 {
+		return nil, fmt.Errorf("unknown error correction level %q", opts.Level)
+	}
+	code, err := qr.Encode(text, qr.Level(level))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode qr code: %w", err)
+	}
+
+	modules := code.Size + 2*opts.Margin
+	if opts.Size < modules {
+		return nil, &SizeError{Size: opts.Size, Min: modules}
+	}
+
+	if opts.Format == FormatSVG {
+		return encodeSVG(code, opts), nil
+	}
+	return encodePNG(code, opts)
+}
+
+// SizeError reports an image size too small for the code.
+type SizeError struct {
+	Size int
+	Min  int
+}
+
+func (e SizeError) Error() string {
+	return fmt.Sprintf("size %d is too small for the qr code, at least %d pixels are needed", e.Size, e.Min)
+}
+
+// layout returns the number of pixels per module and the offset of the quiet zone in the image.
+func layout(code *qr.Code, opts Options) (scale, offset int) {
+	modules := code.Size + 2*opts.Margin
+	scale = opts.Size / modules
+	return scale, (opts.Size - scale*modules) / 2
+}
+
+func encodePNG(code *qr.Code, opts Options) ([]byte, error) {
+	scale, offset := layout(code, opts)
+	origin := offset + opts.Margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{color.White, color.Black})
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if !code.Black(x, y) {
+				continue
+			}
+			for py := origin + y*scale; py < origin+(y+1)*scale; py++ {
+				for px := origin + x*scale; px < origin+(x+1)*scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	err := encoder.Encode(&buf, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeSVG draws the dark modules as a single path, joining the modules of each row into runs.
+func encodeSVG(code *qr.Code, opts Options) []byte {
+	scale, offset := layout(code, opts)
+	origin := offset + opts.Margin*scale
+
+	var path strings.Builder
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; {
+			if !code.Black(x, y) {
+				x++
+				continue
+			}
+			run := 1
+			for code.Black(x+run, y) {
+				run++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv%dh-%dz", origin+x*scale, origin+y*scale, run*scale, scale, run*scale)
+			x += run
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, opts.Size, opts.Size)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`, path.String())
+	return buf.Bytes()
+}
@@ -0,0 +1,80 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"image"
+	"image/color"
+	"image/png"
+	"rsc.io/qr"
+	"strings"
+	"testing"
+)
+
+const text = "http://localhost:8080/abc"
+
+func TestEncodePNG(t *testing.T) {
+	code, err := qr.Encode(text, qr.H)
+	require.NoError(t, err)
+
+	for _, margin := range []int{0, 4} {
+		opts := Options{Format: FormatPNG, Size: 200, Level: "H", Margin: margin}
+		data, err := Encode(text, opts)
+		require.NoError(t, err)
+
+		img, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.Equal(t, image.Rect(0, 0, 200, 200), img.Bounds())
+
+		scale, offset := layout(code, opts)
+		require.Positive(t, scale)
+		origin := offset + margin*scale
+		black := func(px, py int) bool {
+			gray := color.GrayModel.Convert(img.At(px, py)).(color.Gray)
+			return gray.Y < 128
+		}
+		for y := 0; y < code.Size; y++ {
+			for x := 0; x < code.Size; x++ {
+				px, py := origin+x*scale, origin+y*scale
+				require.Equal(t, code.Black(x, y), black(px, py), "module %d,%d", x, y)
+				require.Equal(t, code.Black(x, y), black(px+scale-1, py+scale-1), "module %d,%d", x, y)
+			}
+		}
+		for p := 0; p < origin; p++ {
+			assert.False(t, black(p, p), "quiet zone %d", p)
+			assert.False(t, black(199-p, 199-p), "quiet zone %d", p)
+		}
+	}
+}
+
+func TestEncodeSVG(t *testing.T) {
+	data, err := Encode(text, Options{Format: FormatSVG, Size: 300, Level: "L", Margin: 2})
+	require.NoError(t, err)
+
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="300" height="300" viewBox="0 0 300 300"`))
+	assert.True(t, strings.HasSuffix(svg, "</svg>"))
+
+	code, err := qr.Encode(text, qr.L)
+	require.NoError(t, err)
+	scale, offset := layout(code, Options{Size: 300, Margin: 2})
+	origin := offset + 2*scale
+	// the top-left finder pattern starts with a run of 7 dark modules
+	assert.Contains(t, svg, fmt.Sprintf(`d="M%d %dh%dv%dh-%dz`, origin, origin, 7*scale, scale, 7*scale))
+}
+
+func TestEncodeErrors(t *testing.T) {
+	_, err := Encode(text, Options{Format: FormatPNG, Size: 20, Level: "M", Margin: 4})
+	var sizeErr *SizeError
+	require.ErrorAs(t, err, &sizeErr)
+	assert.Equal(t, 20, sizeErr.Size)
+	assert.Equal(t, 33, sizeErr.Min)
+
+	_, err = Encode(text, Options{Format: FormatPNG, Size: 200, Level: "X"})
+	assert.ErrorContains(t, err, `unknown error correction level "X"`)
+
+	_, err = Encode(strings.Repeat("x", 5000), DefaultOptions)
+	assert.Error(t, err)
+}
@@ -0,0 +1,20 @@
+// Package random generates unpredictable identifiers and keys.
+package random
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Bytes returns n random bytes.
+func Bytes(n int) []byte {
+	buf := make([]byte, n)
+	// crypto/rand.Read never returns an error on supported platforms
+	rand.Read(buf)
+	return buf
+}
+
+// ID returns a random 128-bit identifier in hex.
+func ID() string {
+	return hex.EncodeToString(Bytes(16))
+}
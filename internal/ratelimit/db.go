@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"time"
+)
+
+// DBLimiter keeps token buckets in the rate_limits table, so limits are shared by all
+// service instances using the same database. The table is created by the repository migrations.
+// Elapsed time is measured by the database clock to be consistent across instances.
+type DBLimiter struct {
+	db *sql.DB
+}
+
+// NewDBLimiter connects to cfg.DatabaseDSN.
+func NewDBLimiter(cfg config.Config) (*DBLimiter, error) {
+	db, err := sql.Open("pgx", cfg.DatabaseDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return &DBLimiter{db: db}, nil
+}
+
+// Allow takes a token from the bucket of key, creating a full bucket on first use.
+// Concurrent requests with the same key are serialized by a row lock.
+func (l *DBLimiter) Allow(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error) {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO rate_limits (key, tokens, updated_at) VALUES ($1, $2, now()) ON CONFLICT (key) DO NOTHING",
+		key, limit.Burst,
+	)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to create rate limit bucket: %w", err)
+	}
+
+	var tokens, elapsed float64
+	err = tx.QueryRowContext(ctx,
+		"SELECT tokens, EXTRACT(EPOCH FROM now() - updated_at) FROM rate_limits WHERE key = $1 FOR UPDATE",
+		key,
+	).Scan(&tokens, &elapsed)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to get rate limit bucket: %w", err)
+	}
+
+	tokens, allowed, retryAfter = take(tokens, time.Duration(elapsed*float64(time.Second)), limit)
+	_, err = tx.ExecContext(ctx,
+		"UPDATE rate_limits SET tokens = $2, updated_at = now() WHERE key = $1",
+		key, tokens,
+	)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to update rate limit bucket: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return allowed, retryAfter, nil
+}
+
+// Close closes the database connection.
+func (l *DBLimiter) Close() error {
+	return l.db.Close()
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestDBLimiter connects to the database of DATABASE_DSN. The limiter uses a single connection
+// with a temporary rate_limits table, which shadows the real one and disappears with the connection.
+func newTestDBLimiter(t *testing.T) *DBLimiter {
+	dsn := os.Getenv("DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("DATABASE_DSN is not set")
+	}
+
+	l, err := NewDBLimiter(config.Config{DatabaseDSN: dsn})
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	l.db.SetMaxOpenConns(1)
+
+	_, err = l.db.Exec(`CREATE TEMPORARY TABLE rate_limits
+(
+    key        TEXT PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ      NOT NULL
+)`)
+	require.NoError(t, err)
+	return l
+}
+
+func TestDBLimiter(t *testing.T) {
+	l := newTestDBLimiter(t)
+	limit := NewLimit(2, 3)
+	ctx := context.Background()
+
+	allow := func(key string) (bool, time.Duration) {
+		allowed, retryAfter, err := l.Allow(ctx, key, limit)
+		require.NoError(t, err)
+		return allowed, retryAfter
+	}
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := allow("a")
+		require.True(t, allowed, "request %d within burst", i)
+	}
+	allowed, retryAfter := allow("a")
+	assert.False(t, allowed)
+	assert.Positive(t, retryAfter)
+	assert.LessOrEqual(t, retryAfter, 500*time.Millisecond)
+
+	allowed, _ = allow("b")
+	assert.True(t, allowed, "buckets are separate per key")
+
+	// move the last update of the bucket a second back, which refills two tokens
+	_, err := l.db.Exec("UPDATE rate_limits SET updated_at = updated_at - INTERVAL '1 second' WHERE key = 'a'")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		allowed, _ = allow("a")
+		assert.True(t, allowed, "refilled token %d", i)
+	}
+	allowed, _ = allow("a")
+	assert.False(t, allowed)
+}
+
+func TestDBLimiterConcurrent(t *testing.T) {
+	l := newTestDBLimiter(t)
+	limit := NewLimit(0.001, 5)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := l.Allow(context.Background(), "c", limit)
+			assert.NoError(t, err)
+			if ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 5, allowed, "concurrent requests never take more tokens than the bucket holds")
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit describes a token bucket: Rate tokens are added per second up to Burst tokens,
+// and every request takes one token. A zero Rate disables limiting.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// NewLimit creates a Limit, defaulting the burst to the number of requests allowed per second.
+func NewLimit(rate float64, burst int) Limit {
+	if burst <= 0 {
+		burst = max(1, int(math.Ceil(rate)))
+	}
+	return Limit{Rate: rate, Burst: burst}
+}
+
+// Enabled reports whether the limit restricts anything.
+func (l Limit) Enabled() bool {
+	return l.Rate > 0
+}
+
+// Limiter decides whether a request identified by key fits into the limit.
+// If it does not, Allow returns how long to wait until the next token is available.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// refill returns the number of tokens in a bucket holding tokens after elapsed time.
+func refill(tokens float64, elapsed time.Duration, limit Limit) float64 {
+	return min(float64(limit.Burst), tokens+elapsed.Seconds()*limit.Rate)
+}
+
+// take refills a bucket holding tokens after elapsed time and tries to take a token from it.
+// It returns the number of tokens left and, when the bucket is empty, the time until a token is available.
+func take(tokens float64, elapsed time.Duration, limit Limit) (left float64, allowed bool, retryAfter time.Duration) {
+	tokens = refill(tokens, elapsed, limit)
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	wait := (1 - tokens) / limit.Rate
+	return tokens, false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
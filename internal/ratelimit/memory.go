@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have been refilled completely are dropped.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// MemoryLimiter keeps token buckets in memory, so limits apply per service instance.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryLimiter creates an empty in-memory limiter.
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token from the bucket of key, creating a full bucket on first use.
+func (m *MemoryLimiter) Allow(_ context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		m.buckets[key] = b
+	}
+	b.limit = limit
+
+	var allowed bool
+	var retryAfter time.Duration
+	b.tokens, allowed, retryAfter = take(b.tokens, now.Sub(b.last), limit)
+	b.last = now
+	return allowed, retryAfter, nil
+}
+
+// sweep drops full buckets, as they are equal to the buckets created on demand.
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if refill(b.tokens, now.Sub(b.last), b.limit) >= float64(b.limit.Burst) {
+			delete(m.buckets, key)
+		}
+	}
+}
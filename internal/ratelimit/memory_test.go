@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	m := NewMemoryLimiter()
+	m.now = func() time.Time { return now }
+	limit := NewLimit(2, 3)
+	ctx := context.Background()
+
+	allow := func(key string) (bool, time.Duration) {
+		allowed, retryAfter, err := m.Allow(ctx, key, limit)
+		require.NoError(t, err)
+		return allowed, retryAfter
+	}
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := allow("a")
+		require.True(t, allowed, "request %d within burst", i)
+	}
+	allowed, retryAfter := allow("a")
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	allowed, _ = allow("b")
+	assert.True(t, allowed, "buckets are separate per key")
+
+	now = now.Add(500 * time.Millisecond)
+	allowed, _ = allow("a")
+	assert.True(t, allowed, "a token is refilled")
+	allowed, _ = allow("a")
+	assert.False(t, allowed)
+
+	now = now.Add(time.Hour)
+	allowed, _ = allow("c")
+	assert.True(t, allowed)
+	assert.NotContains(t, m.buckets, "a", "full buckets are swept")
+	assert.NotContains(t, m.buckets, "b")
+}
+
+func TestNewLimit(t *testing.T) {
+	assert.Equal(t, Limit{Rate: 0.5, Burst: 1}, NewLimit(0.5, 0))
+	assert.Equal(t, Limit{Rate: 2.5, Burst: 3}, NewLimit(2.5, 0))
+	assert.Equal(t, Limit{Rate: 1, Burst: 10}, NewLimit(1, 10))
+	assert.False(t, NewLimit(0, 0).Enabled())
+}
@@ -2,44 +2,187 @@ package repository
 
 import (
 	"context"
+	"fmt"
 	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/logger"
 	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/kuznet1/urlshrt/internal/random"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// DeleteListener receives the results of every batch of deletions and restores processed by the deletion worker.
+type DeleteListener func(results []model.DeleteResult)
+
 type deleteLinkReq struct {
 	userID int
 	urlid  model.URLID
+	// restore asks to undo the deletion of the link instead of deleting it
+	restore bool
+	// operationID and opItem locate the request in the operation it belongs to, if any
+	operationID string
+	opItem      int
+	// requestID is the id of the request that asked for the deletion, so worker logs can be correlated with it
+	requestID string
+	// span links the batch span to the trace of the request
+	span trace.SpanContext
 }
 
+// heartbeatInterval is how often the idle deletion worker reports it is alive.
+const heartbeatInterval = time.Second
+
+// workerStallTimeout is how long the deletion worker may stay silent, including a batch processing time.
+const workerStallTimeout = 30 * time.Second
+
 type batchRemover struct {
-	cfg   config.Config
-	delCh chan deleteLinkReq
+	cfg       config.Config
+	delCh     chan deleteLinkReq
+	mu        sync.RWMutex
+	listeners []DeleteListener
+	// heartbeat is the unix time in nanoseconds the deletion worker was last seen running
+	heartbeat atomic.Int64
+	// createOperation stores a new operation before its requests are queued
+	createOperation func(ctx context.Context, op model.Operation) error
+}
+
+func newBatchRemover(cfg config.Config, createOperation func(ctx context.Context, op model.Operation) error) *batchRemover {
+	res := &batchRemover{cfg: cfg, delCh: make(chan deleteLinkReq, 1), createOperation: createOperation}
+	res.heartbeat.Store(time.Now().UnixNano())
+	return res
+}
+
+// WorkerAlive returns an error if the deletion worker has stopped or got stuck.
+func (m *batchRemover) WorkerAlive() error {
+	silence := time.Since(time.Unix(0, m.heartbeat.Load()))
+	if silence > workerStallTimeout {
+		return fmt.Errorf("deletion worker has not responded for %s", silence.Round(time.Second))
+	}
+	return nil
+}
+
+// BatchDelete queues the deletion of links and returns the id of the operation tracking the outcomes.
+func (m *batchRemover) BatchDelete(ctx context.Context, urlids []model.URLID) (string, error) {
+	return m.enqueue(ctx, urlids, false)
 }
 
-func newBatchRemover(cfg config.Config) batchRemover {
-	return batchRemover{cfg: cfg, delCh: make(chan deleteLinkReq, 1)}
+// BatchRestore queues the restoration of deleted links and returns the id of the operation tracking the outcomes.
+// Links deleted more than cfg.RestoreWindow ago are not restored.
+func (m *batchRemover) BatchRestore(ctx context.Context, urlids []model.URLID) (string, error) {
+	return m.enqueue(ctx, urlids, true)
 }
 
-// BatchDelete is a method that provides public behavior for the corresponding type.
-func (m *batchRemover) BatchDelete(ctx context.Context, urlids []model.URLID) error {
+func (m *batchRemover) enqueue(ctx context.Context, urlids []model.URLID, restore bool) (string, error) {
 	userID, err := GetUserID(ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
 
+	op := model.Operation{ID: random.ID(), UserID: userID, Restore: restore, CreatedAt: time.Now()}
 	for _, urlid := range urlids {
-		m.delCh <- deleteLinkReq{userID: userID, urlid: urlid}
+		op.Items = append(op.Items, model.OperationItem{URLID: urlid})
+	}
+	err = m.createOperation(ctx, op)
+	if err != nil {
+		return "", fmt.Errorf("failed to create operation: %w", err)
 	}
 
-	return nil
+	requestID := logger.RequestID(ctx)
+	span := trace.SpanContextFromContext(ctx)
+	for i, urlid := range urlids {
+		m.delCh <- deleteLinkReq{
+			userID:      userID,
+			urlid:       urlid,
+			restore:     restore,
+			operationID: op.ID,
+			opItem:      i,
+			requestID:   requestID,
+			span:        span,
+		}
+	}
+
+	return op.ID, nil
+}
+
+// restoreDeadline returns the earliest deletion time of a restorable link, or the zero time if there is no limit.
+func (m *batchRemover) restoreDeadline(now time.Time) time.Time {
+	if m.cfg.RestoreWindow <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-m.cfg.RestoreWindow)
 }
 
-func (m *batchRemover) deletionWorker(deleteFunc func(batch []deleteLinkReq)) {
+// deleteNow applies the deletion of a single link immediately, bypassing the batch queue,
+// and notifies the listeners about the outcome.
+func (m *batchRemover) deleteNow(ctx context.Context, urlid model.URLID,
+	deleteFunc func(ctx context.Context, batch []deleteLinkReq) []model.DeleteResult) error {
+	userID, err := GetUserID(ctx)
+	if err != nil {
+		return err
+	}
+
+	req := deleteLinkReq{userID: userID, urlid: urlid, requestID: logger.RequestID(ctx), span: trace.SpanContextFromContext(ctx)}
+	results := deleteFunc(ctx, []deleteLinkReq{req})
+	m.notify(results)
+
+	switch results[0].Outcome {
+	case model.DeleteOutcomeDeleted:
+		return nil
+	case model.DeleteOutcomeNotFound:
+		return linkNotFoundError(urlid)
+	case model.DeleteOutcomeNotOwned:
+		return linkNotOwnedError(urlid)
+	}
+	return fmt.Errorf("failed to delete url for shortening %q", urlid)
+}
+
+// OnDelete registers a listener notified with the outcome of each processed deletion batch.
+func (m *batchRemover) OnDelete(listener DeleteListener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+func (m *batchRemover) notify(results []model.DeleteResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, listener := range m.listeners {
+		listener(results)
+	}
+}
+
+func failedResults(reqs []deleteLinkReq) []model.DeleteResult {
+	res := make([]model.DeleteResult, 0, len(reqs))
+	for _, req := range reqs {
+		res = append(res, req.result(model.DeleteOutcomeFailed))
+	}
+	return res
+}
+
+func (m *batchRemover) deletionWorker(deleteFunc func(ctx context.Context, batch []deleteLinkReq) []model.DeleteResult) {
 	var timer *time.Timer
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
 	batch := make([]deleteLinkReq, 0, m.cfg.DeleteBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, span := startBatchSpan(batch)
+		m.notify(deleteFunc(ctx, batch))
+		span.End()
+		batch = batch[:0]
+	}
 
 	for {
+		m.heartbeat.Store(time.Now().UnixNano())
 		var timerC <-chan time.Time
 		if timer != nil {
 			timerC = timer.C
@@ -58,8 +201,7 @@ func (m *batchRemover) deletionWorker(deleteFunc func(batch []deleteLinkReq)) {
 				}
 			}
 
-			deleteFunc(batch)
-			batch = batch[:0]
+			flush()
 
 			if !ok {
 				return
@@ -70,9 +212,11 @@ func (m *batchRemover) deletionWorker(deleteFunc func(batch []deleteLinkReq)) {
 				timer = nil
 			}
 
+		case <-heartbeat.C:
+			// the heartbeat is stored at the top of the loop
+
 		case <-timerC:
-			deleteFunc(batch)
-			batch = batch[:0]
+			flush()
 
 			if timer != nil {
 				timer.Stop()
@@ -81,3 +225,41 @@ func (m *batchRemover) deletionWorker(deleteFunc func(batch []deleteLinkReq)) {
 		}
 	}
 }
+
+// result returns the result of the request with the given outcome.
+func (req deleteLinkReq) result(outcome model.DeleteOutcome) model.DeleteResult {
+	return model.DeleteResult{
+		UserID:      req.userID,
+		URLID:       req.urlid,
+		Restore:     req.restore,
+		OperationID: req.operationID,
+		Outcome:     outcome,
+	}
+}
+
+// logFields returns the fields identifying the request in the deletion worker logs.
+func (req deleteLinkReq) logFields() []zap.Field {
+	return []zap.Field{
+		zap.String("request_id", req.requestID),
+		zap.Int("user_id", req.userID),
+		zap.Uint64("url_id", uint64(req.urlid)),
+		zap.Bool("restore", req.restore),
+		zap.String("operation_id", req.operationID),
+	}
+}
+
+// startBatchSpan starts a root span of a deletion batch linked to the spans of the requests
+// that asked for the deletions, as the batch outlives them.
+func startBatchSpan(batch []deleteLinkReq) (context.Context, trace.Span) {
+	var links []trace.Link
+	for _, req := range batch {
+		if req.span.IsValid() {
+			links = append(links, trace.Link{SpanContext: req.span})
+		}
+	}
+	return tracer.Start(context.Background(), "deletion batch",
+		trace.WithNewRoot(),
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("batch.size", len(batch))),
+	)
+}
@@ -8,23 +8,28 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/kuznet1/urlshrt/internal/config"
 	"github.com/kuznet1/urlshrt/internal/errs"
 	"github.com/kuznet1/urlshrt/internal/model"
 	"go.uber.org/zap"
-	"net/http"
+	"strings"
+	"time"
 )
 
+// uniqueViolation is the PostgreSQL error code of a unique constraint violation.
+const uniqueViolation = "23505"
+
 // DBRepo is a PostgreSQL-backed implementation of Repo.
 // It stores short URLs in a relational database and supports batch operations and per-user ownership.
 type DBRepo struct {
-	batchRemover
+	*batchRemover
 	db     *sql.DB
 	logger *zap.Logger
 }
 
-// NewDBRepo performs a public package operation. Top-level handler/function.
+// NewDBRepo connects to the database of cfg.DatabaseDSN and applies the migrations.
 func NewDBRepo(cfg config.Config, logger *zap.Logger) (*DBRepo, error) {
 	db, err := sql.Open("pgx", cfg.DatabaseDSN)
 	if err != nil {
@@ -34,13 +39,14 @@ func NewDBRepo(cfg config.Config, logger *zap.Logger) (*DBRepo, error) {
 	if err != nil {
 		return nil, err
 	}
-	res := &DBRepo{newBatchRemover(cfg), db, logger}
+	res := &DBRepo{db: db, logger: logger}
+	res.batchRemover = newBatchRemover(cfg, res.createOperation)
 	go res.deletionWorker(res.deleteImpl)
 	return res, nil
 }
 
-// Put is a method that provides public behavior for the corresponding type.
-func (m *DBRepo) Put(ctx context.Context, url string) (model.URLID, error) {
+// Put stores the link of the user, or returns a DuplicatedURLError with the id of the link holding the URL.
+func (m *DBRepo) Put(ctx context.Context, target model.LinkTarget) (model.URLID, error) {
 	userID, err := GetUserID(ctx)
 	if err != nil {
 		return 0, err
@@ -60,15 +66,19 @@ func (m *DBRepo) Put(ctx context.Context, url string) (model.URLID, error) {
 		}
 	}()
 
-	res, err := doPut(url, userID, tx)
+	res, err := doPut(ctx, target, userID, tx)
 
 	done = true
 	return res, err
 }
 
-func doPut(url string, userID int, tx *sql.Tx) (model.URLID, error) {
+func doPut(ctx context.Context, target model.LinkTarget, userID int, tx *sql.Tx) (model.URLID, error) {
 	var urlid model.URLID
-	err := tx.QueryRow("INSERT INTO links (url, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING RETURNING id", url, userID).Scan(&urlid)
+	key := dedupKey(target.URL, target.Normalized)
+	err := scanTraced(ctx, tx,
+		"INSERT INTO links (url, normalized_url, user_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING RETURNING id",
+		[]any{&urlid}, target.URL, key, userID,
+	)
 	if err == nil {
 		return urlid, nil
 	}
@@ -77,33 +87,51 @@ func doPut(url string, userID int, tx *sql.Tx) (model.URLID, error) {
 		return 0, fmt.Errorf("failed to insert url: %w", err)
 	}
 
-	err = tx.QueryRow("SELECT id FROM links WHERE url = $1", url).Scan(&urlid)
+	err = scanTraced(ctx, tx, "SELECT id FROM links WHERE normalized_url = $1", []any{&urlid}, key)
 	if err != nil {
 		return 0, fmt.Errorf("url is duplicated, but unable to get existing: %w", err)
 	}
 
-	return urlid, errs.NewDuplicatedURLError(url)
+	return urlid, errs.NewDuplicatedURLError(target.URL)
 }
 
-// Get is a method that provides public behavior for the corresponding type.
-func (m *DBRepo) Get(ctx context.Context, id model.URLID) (string, error) {
-	var url string
-	var isDeleted bool
-	err := m.db.QueryRowContext(ctx, "SELECT url, is_deleted FROM links WHERE id = $1", id).Scan(&url, &isDeleted)
+// Get returns the link unless it is deleted.
+func (m *DBRepo) Get(ctx context.Context, id model.URLID) (model.Link, error) {
+	link := model.Link{ID: id}
+	err := scanTraced(ctx, m.db,
+		"SELECT url, title, user_id, created_at, clicks, is_deleted, interstitial FROM links WHERE id = $1",
+		[]any{&link.URL, &link.Title, &link.UserID, &link.CreatedAt, &link.Clicks, &link.IsDeleted, &link.Interstitial},
+		id,
+	)
 
 	if err == sql.ErrNoRows {
-		return "", errs.NewHTTPError(fmt.Sprintf("url for shortening %q doesn't exist", id), http.StatusNotFound)
+		_, purged, err := tombstoneOwner(ctx, m.db, id)
+		if err != nil {
+			return model.Link{}, err
+		}
+		if purged {
+			return model.Link{}, linkDeletedError(id)
+		}
+		return model.Link{}, linkNotFoundError(id)
 	}
 
-	if isDeleted {
-		return "", errs.NewHTTPError(fmt.Sprintf("url for shortening %q is deleted", id), http.StatusGone)
+	if link.IsDeleted {
+		return model.Link{}, linkDeletedError(id)
 	}
 
-	return url, err
+	return link, err
 }
 
-// BatchPut is a method that provides public behavior for the corresponding type.
-func (m *DBRepo) BatchPut(ctx context.Context, urls []string) ([]model.URLID, error) {
+// CountClick counts a click of the link unless it is deleted.
+func (m *DBRepo) CountClick(ctx context.Context, id model.URLID) error {
+	_, err := execTraced(ctx, m.db, "UPDATE links SET clicks = clicks + 1 WHERE id = $1 AND NOT is_deleted", id)
+	if err != nil {
+		return fmt.Errorf("failed to count click: %w", err)
+	}
+	return nil
+}
+
+func (m *DBRepo) BatchPut(ctx context.Context, targets []model.LinkTarget) ([]model.URLID, error) {
 	userID, err := GetUserID(ctx)
 	if err != nil {
 		return nil, err
@@ -124,8 +152,12 @@ func (m *DBRepo) BatchPut(ctx context.Context, urls []string) ([]model.URLID, er
 	}()
 
 	var res []model.URLID
-	for _, url := range urls {
-		id, err1 := doPut(url, userID, tx)
+	for i, target := range targets {
+		id, err1 := doPut(ctx, target, userID, tx)
+		var dup *errs.DuplicatedURLError
+		if errors.As(err1, &dup) {
+			dup.Index = i
+		}
 		err = errors.Join(err, err1)
 		res = append(res, id)
 	}
@@ -138,82 +170,543 @@ func (m *DBRepo) BatchPut(ctx context.Context, urls []string) ([]model.URLID, er
 	return res, err
 }
 
-func (m *DBRepo) deleteImpl(reqs []deleteLinkReq) {
-	tx, err := m.db.Begin()
+// deleteImpl applies a batch of deletion and restore requests in a transaction.
+func (m *DBRepo) deleteImpl(ctx context.Context, reqs []deleteLinkReq) []model.DeleteResult {
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
 		m.logger.Error("failed to begin transaction", zap.Error(err))
-		return
+		return m.failBatch(ctx, reqs)
 	}
 
-	done := false
-	defer func() {
-		if done {
-			tx.Commit()
+	deadline := m.restoreDeadline(time.Now())
+	res := make([]model.DeleteResult, 0, len(reqs))
+	for _, req := range reqs {
+		var outcome model.DeleteOutcome
+		if req.restore {
+			outcome, err = restoreLink(ctx, tx, req, deadline)
 		} else {
-			tx.Rollback()
+			outcome, err = deleteLink(ctx, tx, req)
 		}
-	}()
+		if err != nil {
+			m.logger.Error("failed to apply link request", append(req.logFields(), zap.Error(err))...)
+		}
+		err = recordOutcome(ctx, tx, req, outcome)
+		if err != nil {
+			m.logger.Error("failed to record operation outcome", append(req.logFields(), zap.Error(err))...)
+		}
+		res = append(res, req.result(outcome))
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		m.logger.Error("failed to commit transaction", zap.Error(err))
+		return m.failBatch(ctx, reqs)
+	}
 
+	return res
+}
+
+// failBatch marks the requests of a batch that could not be applied as failed in their operations.
+func (m *DBRepo) failBatch(ctx context.Context, reqs []deleteLinkReq) []model.DeleteResult {
 	for _, req := range reqs {
-		res, err := tx.Exec(
-			"UPDATE links SET is_deleted = TRUE WHERE user_id = $1 AND id = $2",
-			req.userID, req.urlid,
+		err := recordOutcome(ctx, m.db, req, model.DeleteOutcomeFailed)
+		if err != nil {
+			m.logger.Error("failed to record operation outcome", append(req.logFields(), zap.Error(err))...)
+		}
+	}
+	return failedResults(reqs)
+}
+
+// recordOutcome sets the outcome of the request in its operation.
+func recordOutcome(ctx context.Context, q querier, req deleteLinkReq, outcome model.DeleteOutcome) error {
+	if req.operationID == "" {
+		return nil
+	}
+	_, err := execTraced(ctx, q,
+		"UPDATE operation_items SET outcome = $3 WHERE operation_id = $1 AND position = $2",
+		req.operationID, req.opItem, string(outcome),
+	)
+	return err
+}
+
+func (m *DBRepo) createOperation(ctx context.Context, op model.Operation) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = execTraced(ctx, tx, "DELETE FROM operations WHERE created_at < $1", op.CreatedAt.Add(-operationTTL))
+	if err != nil {
+		return fmt.Errorf("failed to delete expired operations: %w", err)
+	}
+
+	_, err = execTraced(ctx, tx,
+		"INSERT INTO operations (id, user_id, restore, created_at) VALUES ($1, $2, $3, $4)",
+		op.ID, op.UserID, op.Restore, op.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert operation: %w", err)
+	}
+
+	urlids := make([]int64, 0, len(op.Items))
+	for _, item := range op.Items {
+		urlids = append(urlids, int64(item.URLID))
+	}
+	_, err = execTraced(ctx, tx,
+		"INSERT INTO operation_items (operation_id, position, url_id) SELECT $1, t.position - 1, t.url_id FROM unnest($2::BIGINT[]) WITH ORDINALITY AS t(url_id, position)",
+		op.ID, urlids,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert operation items: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Operation returns the user's operation with the outcomes of its items.
+func (m *DBRepo) Operation(ctx context.Context, id string) (model.Operation, error) {
+	userID, err := GetUserID(ctx)
+	if err != nil {
+		return model.Operation{}, err
+	}
+
+	op := model.Operation{ID: id}
+	err = scanTraced(ctx, m.db,
+		"SELECT user_id, restore, created_at FROM operations WHERE id = $1 AND created_at >= $2",
+		[]any{&op.UserID, &op.Restore, &op.CreatedAt}, id, time.Now().Add(-operationTTL),
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Operation{}, operationNotFoundError(id)
+	}
+	if err != nil {
+		return model.Operation{}, fmt.Errorf("failed to get operation: %w", err)
+	}
+	if op.UserID != userID {
+		return model.Operation{}, operationNotOwnedError(id)
+	}
+
+	rows, err := queryTraced(ctx, m.db, "SELECT url_id, outcome FROM operation_items WHERE operation_id = $1 ORDER BY position", id)
+	if err != nil {
+		return model.Operation{}, fmt.Errorf("failed to query operation items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item model.OperationItem
+		err = rows.Scan(&item.URLID, &item.Outcome)
+		if err != nil {
+			return model.Operation{}, fmt.Errorf("failed to scan operation item: %w", err)
+		}
+		op.Items = append(op.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return model.Operation{}, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return op, nil
+}
+
+func deleteLink(ctx context.Context, tx *sql.Tx, req deleteLinkReq) (model.DeleteOutcome, error) {
+	res, err := execTraced(ctx, tx,
+		"UPDATE links SET is_deleted = TRUE, deleted_at = COALESCE(deleted_at, now()) WHERE user_id = $1 AND id = $2",
+		req.userID, req.urlid,
+	)
+	if err != nil {
+		return model.DeleteOutcomeFailed, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return model.DeleteOutcomeFailed, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows != 0 {
+		return model.DeleteOutcomeDeleted, nil
+	}
+
+	return missingLinkOutcome(ctx, tx, req)
+}
+
+// restoreLink undoes the deletion of the link if it was deleted after the deadline.
+// Links deleted at an unknown time are not restored unless the deadline is zero.
+func restoreLink(ctx context.Context, tx *sql.Tx, req deleteLinkReq, deadline time.Time) (model.DeleteOutcome, error) {
+	var isDeleted bool
+	var deletedAt sql.NullTime
+	err := scanTraced(ctx, tx,
+		"SELECT is_deleted, deleted_at FROM links WHERE user_id = $1 AND id = $2 FOR UPDATE",
+		[]any{&isDeleted, &deletedAt}, req.userID, req.urlid,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return missingLinkOutcome(ctx, tx, req)
+	}
+	if err != nil {
+		return model.DeleteOutcomeFailed, err
+	}
+
+	switch {
+	case !isDeleted:
+		return model.DeleteOutcomeNotDeleted, nil
+	case !deadline.IsZero() && (!deletedAt.Valid || deletedAt.Time.Before(deadline)):
+		return model.DeleteOutcomeExpired, nil
+	}
+
+	_, err = execTraced(ctx, tx, "UPDATE links SET is_deleted = FALSE, deleted_at = NULL WHERE id = $1", req.urlid)
+	if err != nil {
+		return model.DeleteOutcomeFailed, err
+	}
+	return model.DeleteOutcomeRestored, nil
+}
+
+// missingLinkOutcome tells whether a link not found among the links of the user belongs to another user
+// or is purged. Deleting a purged link of the user succeeds, while restoring it is too late.
+func missingLinkOutcome(ctx context.Context, tx *sql.Tx, req deleteLinkReq) (model.DeleteOutcome, error) {
+	var exists bool
+	err := scanTraced(ctx, tx, "SELECT EXISTS (SELECT 1 FROM links WHERE id = $1)", []any{&exists}, req.urlid)
+	if err != nil {
+		return model.DeleteOutcomeFailed, fmt.Errorf("failed to check link existence: %w", err)
+	}
+	if exists {
+		return model.DeleteOutcomeNotOwned, errors.New("access denied")
+	}
+
+	owner, purged, err := tombstoneOwner(ctx, tx, req.urlid)
+	switch {
+	case err != nil:
+		return model.DeleteOutcomeFailed, err
+	case !purged:
+		return model.DeleteOutcomeNotFound, errors.New("no such link")
+	case owner != req.userID:
+		return model.DeleteOutcomeNotOwned, errors.New("access denied")
+	case req.restore:
+		return model.DeleteOutcomeExpired, nil
+	}
+	return model.DeleteOutcomeDeleted, nil
+}
+
+// tombstoneOwner returns the owner of the purged link with the given id, or false if the link is not purged.
+func tombstoneOwner(ctx context.Context, q querier, id model.URLID) (int, bool, error) {
+	var owner sql.NullInt64
+	err := scanTraced(ctx, q, "SELECT user_id FROM link_tombstones WHERE id = $1", []any{&owner}, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to check link tombstone: %w", err)
+	}
+	return int(owner.Int64), true, nil
+}
+
+// renormalizeBatchSize limits the number of links read at once by Renormalize.
+const renormalizeBatchSize = 1000
+
+// Renormalize updates the normalized forms of the stored URLs that differ from normalize, reading the links in batches.
+// A link whose new form is already held by another link keeps its current form, so both stay reachable.
+func (m *DBRepo) Renormalize(ctx context.Context, normalize func(url string) string) (int64, error) {
+	var updated int64
+	var lastID model.URLID
+	for {
+		links, err := m.normalizedURLs(ctx, lastID)
+		if err != nil {
+			return updated, err
+		}
+		if len(links) == 0 {
+			return updated, nil
+		}
+		lastID = links[len(links)-1].id
+
+		for _, l := range links {
+			key := normalize(l.url)
+			if key == l.normalized {
+				continue
+			}
+			res, err := execTraced(ctx, m.db,
+				"UPDATE links SET normalized_url = $2 WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM links WHERE normalized_url = $2)",
+				l.id, key,
+			)
+			var n int64
+			var pgErr *pgconn.PgError
+			switch {
+			case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation:
+				// another link got the same form concurrently
+			case err != nil:
+				return updated, fmt.Errorf("failed to update normalized url: %w", err)
+			default:
+				n, err = res.RowsAffected()
+				if err != nil {
+					return updated, fmt.Errorf("failed to get affected rows: %w", err)
+				}
+			}
+			if n == 0 {
+				m.logger.Warn("normalized url is held by another link", zap.Uint64("id", l.id.ID()), zap.String("url", l.url))
+			}
+			updated += n
+		}
+	}
+}
+
+type normalizedURL struct {
+	id         model.URLID
+	url        string
+	normalized string
+}
+
+func (m *DBRepo) normalizedURLs(ctx context.Context, afterID model.URLID) ([]normalizedURL, error) {
+	rows, err := queryTraced(ctx, m.db,
+		"SELECT id, url, normalized_url FROM links WHERE id > $1 ORDER BY id LIMIT $2", afterID, renormalizeBatchSize,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query urls: %w", err)
+	}
+	defer rows.Close()
+
+	var res []normalizedURL
+	for rows.Next() {
+		var l normalizedURL
+		err = rows.Scan(&l.id, &l.url, &l.normalized)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan url: %w", err)
+		}
+		res = append(res, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return res, nil
+}
+
+// purgeBatchSize limits the number of links purged by a single statement, so the rows are not locked for long.
+const purgeBatchSize = 1000
+
+// Purge moves links deleted before deletedBefore to tombstones, removing their edit history.
+// Links deleted at an unknown time are purged too.
+func (m *DBRepo) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var total int64
+	for {
+		res, err := execTraced(ctx, m.db, `WITH purged AS (
+    DELETE FROM links WHERE id IN (
+        SELECT id FROM links WHERE is_deleted AND (deleted_at IS NULL OR deleted_at < $1) LIMIT $2
+    ) RETURNING id, user_id, deleted_at
+)
+INSERT INTO link_tombstones (id, user_id, deleted_at) SELECT id, user_id, deleted_at FROM purged`,
+			deletedBefore, purgeBatchSize,
 		)
 		if err != nil {
-			m.logger.Error("failed to delete link", zap.Error(err))
+			return total, fmt.Errorf("failed to purge links: %w", err)
 		}
+
 		rows, err := res.RowsAffected()
 		if err != nil {
-			m.logger.Error("failed to get affected rows", zap.Error(err))
+			return total, fmt.Errorf("failed to get affected rows: %w", err)
 		}
-		if rows == 0 {
-			m.logger.Error("no such link or access denied")
+		total += rows
+		if rows < purgeBatchSize {
+			return total, nil
 		}
 	}
-
-	done = true
 }
 
-// Ping is a method that provides public behavior for the corresponding type.
+// Ping checks the database connection.
 func (m *DBRepo) Ping(ctx context.Context) error {
 	return m.db.PingContext(ctx)
 }
 
-// UserUrls is a method that provides public behavior for the corresponding type.
-func (m *DBRepo) UserUrls(ctx context.Context) (map[model.URLID]string, error) {
+// UserUrls returns a page of the user's links in the order of the query using keyset pagination.
+func (m *DBRepo) UserUrls(ctx context.Context, q model.LinkQuery) ([]model.Link, string, error) {
 	userID, err := GetUserID(ctx)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	args := []any{userID}
+	conds := []string{"user_id = $1"}
+	if q.Search != "" {
+		args = append(args, q.Search)
+		conds = append(conds, fmt.Sprintf("strpos(url, $%d) > 0", len(args)))
+	}
+
+	direction, comparison := "ASC", ">"
+	if q.Desc {
+		direction, comparison = "DESC", "<"
 	}
 
-	rows, err := m.db.QueryContext(ctx, "SELECT id, url FROM links WHERE user_id = $1", userID)
+	if q.Cursor != "" {
+		cursor, err := parseLinkCursor(q.Cursor, q.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+		if q.Sort == model.LinkSortClicks {
+			args = append(args, cursor.clicks, cursor.id)
+			conds = append(conds, fmt.Sprintf("(clicks, id) %s ($%d, $%d)", comparison, len(args)-1, len(args)))
+		} else {
+			args = append(args, cursor.id)
+			conds = append(conds, fmt.Sprintf("id %s $%d", comparison, len(args)))
+		}
+	}
+
+	order := "id " + direction
+	if q.Sort == model.LinkSortClicks {
+		order = fmt.Sprintf("clicks %s, id %s", direction, direction)
+	}
+	args = append(args, q.Limit+1)
+	query := fmt.Sprintf(
+		"SELECT id, url, title, user_id, created_at, clicks, is_deleted, deleted_at FROM links WHERE %s ORDER BY %s LIMIT $%d",
+		strings.Join(conds, " AND "), order, len(args),
+	)
+
+	rows, err := queryTraced(ctx, m.db, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query urls: %w", err)
+		return nil, "", fmt.Errorf("failed to query urls: %w", err)
 	}
 	defer rows.Close()
 
-	res := make(map[model.URLID]string)
+	var res []model.Link
 	for rows.Next() {
-		var id model.URLID
-		var url string
-		err = rows.Scan(&id, &url)
+		var link model.Link
+		err = rows.Scan(&link.ID, &link.URL, &link.Title, &link.UserID, &link.CreatedAt, &link.Clicks, &link.IsDeleted, &link.DeletedAt)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan url: %w", err)
+			return nil, "", fmt.Errorf("failed to scan url: %w", err)
 		}
-		res[id] = url
+		res = append(res, link)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows iteration error: %w", err)
+		return nil, "", fmt.Errorf("rows iteration error: %w", err)
 	}
 
-	return res, nil
+	res, next := nextCursor(res, q)
+	return res, next, nil
+}
+
+// ownLink returns the link with the given id if it belongs to the user of ctx.
+// The forUpdate suffix locks the row until the end of the transaction.
+func ownLink(ctx context.Context, q querier, id model.URLID, forUpdate bool) (model.Link, error) {
+	userID, err := GetUserID(ctx)
+	if err != nil {
+		return model.Link{}, err
+	}
+
+	query := "SELECT id, url, title, user_id, created_at, clicks, is_deleted, deleted_at, interstitial FROM links WHERE id = $1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+	var link model.Link
+	err = scanTraced(ctx, q, query,
+		[]any{&link.ID, &link.URL, &link.Title, &link.UserID, &link.CreatedAt, &link.Clicks, &link.IsDeleted, &link.DeletedAt, &link.Interstitial}, id,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		owner, purged, err := tombstoneOwner(ctx, q, id)
+		switch {
+		case err != nil:
+			return model.Link{}, err
+		case !purged:
+			return model.Link{}, linkNotFoundError(id)
+		case owner != userID:
+			return model.Link{}, linkNotOwnedError(id)
+		}
+		return model.Link{}, linkDeletedError(id)
+	}
+	if err != nil {
+		return model.Link{}, fmt.Errorf("failed to get link: %w", err)
+	}
+	if link.UserID != userID {
+		return model.Link{}, linkNotOwnedError(id)
+	}
+	return link, nil
+}
+
+// Link returns the user's link with its edit history.
+func (m *DBRepo) Link(ctx context.Context, id model.URLID) (model.Link, []model.LinkEdit, error) {
+	link, err := ownLink(ctx, m.db, id, false)
+	if err != nil {
+		return model.Link{}, nil, err
+	}
+
+	rows, err := queryTraced(ctx, m.db,
+		"SELECT edited_at, old_url, new_url, old_title, new_title FROM link_edits WHERE link_id = $1 ORDER BY id", id,
+	)
+	if err != nil {
+		return model.Link{}, nil, fmt.Errorf("failed to query link edits: %w", err)
+	}
+	defer rows.Close()
+
+	var history []model.LinkEdit
+	for rows.Next() {
+		var edit model.LinkEdit
+		err = rows.Scan(&edit.EditedAt, &edit.OldURL, &edit.NewURL, &edit.OldTitle, &edit.NewTitle)
+		if err != nil {
+			return model.Link{}, nil, fmt.Errorf("failed to scan link edit: %w", err)
+		}
+		history = append(history, edit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return model.Link{}, nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return link, history, nil
+}
+
+// UpdateLink changes the user's link and records the edit in its history.
+func (m *DBRepo) UpdateLink(ctx context.Context, id model.URLID, upd model.LinkUpdate) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	link, err := ownLink(ctx, tx, id, true)
+	if err != nil {
+		return err
+	}
+	if link.IsDeleted {
+		return linkDeletedError(id)
+	}
+
+	updated, edit, changed := applyUpdate(link, upd, time.Now())
+	if !changed {
+		return nil
+	}
+
+	key := dedupKey(updated.URL, upd.NormalizedURL)
+	if updated.URL == link.URL {
+		key = ""
+	}
+	_, err = execTraced(ctx, tx,
+		"UPDATE links SET url = $2, title = $3, interstitial = $4, normalized_url = COALESCE(NULLIF($5, ''), normalized_url) WHERE id = $1",
+		id, updated.URL, updated.Title, updated.Interstitial, key,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return errs.NewDuplicatedURLError(updated.URL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update link: %w", err)
+	}
+
+	if edit == nil {
+		return tx.Commit()
+	}
+	_, err = execTraced(ctx, tx,
+		"INSERT INTO link_edits (link_id, user_id, edited_at, old_url, new_url, old_title, new_title) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		id, link.UserID, edit.EditedAt, edit.OldURL, edit.NewURL, edit.OldTitle, edit.NewTitle,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record link edit: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// DeleteLink deletes the user's link immediately.
+func (m *DBRepo) DeleteLink(ctx context.Context, id model.URLID) error {
+	return m.deleteNow(ctx, id, m.deleteImpl)
 }
 
-// CreateUser is a method that provides public behavior for the corresponding type.
+// CreateUser registers a new user and returns its id.
 func (m *DBRepo) CreateUser(ctx context.Context) (int, error) {
 	var userID int
-	err := m.db.QueryRowContext(ctx, "INSERT INTO users DEFAULT VALUES RETURNING id").Scan(&userID)
+	err := scanTraced(ctx, m.db, "INSERT INTO users DEFAULT VALUES RETURNING id", []any{&userID})
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert user: %w", err)
 	}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/errs"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// linkCursor is the position of a link in a listing: its sort key and the id breaking ties.
+// Links are created in the id order, so the id alone is the key of the creation order.
+type linkCursor struct {
+	clicks int64
+	id     model.URLID
+}
+
+func cursorOf(link model.Link) linkCursor {
+	return linkCursor{clicks: link.Clicks, id: link.ID}
+}
+
+// format encodes the cursor as "<id>" for the creation order and "<clicks>.<id>" for the clicks order.
+func (c linkCursor) format(sort model.LinkSort) string {
+	if sort == model.LinkSortClicks {
+		return fmt.Sprintf("%d.%d", c.clicks, c.id)
+	}
+	return strconv.FormatUint(c.id.ID(), 10)
+}
+
+func parseLinkCursor(s string, sort model.LinkSort) (linkCursor, error) {
+	invalid := errs.NewHTTPError(fmt.Sprintf("invalid cursor %q", s), http.StatusBadRequest)
+	var res linkCursor
+	idPart := s
+	if sort == model.LinkSortClicks {
+		clicksPart, rest, ok := strings.Cut(s, ".")
+		if !ok {
+			return res, invalid
+		}
+		clicks, err := strconv.ParseInt(clicksPart, 10, 64)
+		if err != nil {
+			return res, invalid
+		}
+		res.clicks, idPart = clicks, rest
+	}
+	id, err := strconv.ParseUint(idPart, 10, 64)
+	if err != nil {
+		return res, invalid
+	}
+	res.id = model.URLID(id)
+	return res, nil
+}
+
+// compare orders cursors ascending by the sort key and then by id.
+func (c linkCursor) compare(other linkCursor, sort model.LinkSort) int {
+	if sort == model.LinkSortClicks {
+		if res := cmp.Compare(c.clicks, other.clicks); res != 0 {
+			return res
+		}
+	}
+	return cmp.Compare(c.id, other.id)
+}
+
+// nextCursor returns the cursor of the page following links, or an empty string if there is no more links.
+// links must contain one link more than the page size when there is a next page.
+func nextCursor(links []model.Link, q model.LinkQuery) ([]model.Link, string) {
+	if len(links) <= q.Limit {
+		return links, ""
+	}
+	links = links[:q.Limit]
+	return links, cursorOf(links[len(links)-1]).format(q.Sort)
+}
+
+func linkNotFoundError(id model.URLID) error {
+	return errs.NewHTTPError(fmt.Sprintf("url for shortening %q doesn't exist", id), http.StatusNotFound)
+}
+
+func linkNotOwnedError(id model.URLID) error {
+	return errs.NewHTTPError(fmt.Sprintf("url for shortening %q belongs to another user", id), http.StatusForbidden)
+}
+
+func linkDeletedError(id model.URLID) error {
+	return errs.NewHTTPError(fmt.Sprintf("url for shortening %q is deleted", id), http.StatusGone)
+}
+
+// dedupKey returns the key identifying duplicated URLs: the normalized form of the url if known, or the url itself.
+func dedupKey(url, normalized string) string {
+	if normalized != "" {
+		return normalized
+	}
+	return url
+}
+
+// applyUpdate returns the link with the update applied and the history entry of the edit,
+// or false if the update does not change the link.
+// The history entry is nil if only the interstitial flag is changed, as the history holds URLs and titles.
+func applyUpdate(link model.Link, upd model.LinkUpdate, now time.Time) (model.Link, *model.LinkEdit, bool) {
+	edit := model.LinkEdit{EditedAt: now, OldURL: link.URL, OldTitle: link.Title}
+	interstitial := link.Interstitial
+	if upd.URL != nil {
+		link.URL = *upd.URL
+	}
+	if upd.Title != nil {
+		link.Title = *upd.Title
+	}
+	if upd.Interstitial != nil {
+		link.Interstitial = *upd.Interstitial
+	}
+	edit.NewURL, edit.NewTitle = link.URL, link.Title
+	if edit.NewURL == edit.OldURL && edit.NewTitle == edit.OldTitle {
+		return link, nil, link.Interstitial != interstitial
+	}
+	return link, &edit, true
+}
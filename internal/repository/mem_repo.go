@@ -9,33 +9,70 @@ import (
 	"github.com/kuznet1/urlshrt/internal/errs"
 	"github.com/kuznet1/urlshrt/internal/model"
 	"go.uber.org/zap"
-	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var errNoDB = errors.New("database is not used")
 
 type link struct {
-	URL       string `json:"url"`
-	UserID    int    `json:"userID"`
-	IsDeleted bool   `json:"isDeleted"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title,omitempty"`
+	UserID    int       `json:"userID"`
+	IsDeleted bool      `json:"isDeleted"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Clicks are counted under the read lock, so they must be accessed atomically unless the lock is held exclusively
+	Clicks    int64            `json:"clicks"`
+	DeletedAt *time.Time       `json:"deletedAt,omitempty"`
+	History   []model.LinkEdit `json:"history,omitempty"`
+	// NormalizedURL is empty for links saved before normalization, which are matched by URL
+	NormalizedURL string `json:"normalizedURL,omitempty"`
+	// Interstitial forces the preview page for every visit of the link
+	Interstitial bool `json:"interstitial,omitempty"`
+	// Purged marks the tombstone of a purged link, which keeps only its owner and deletion time
+	Purged bool `json:"purged,omitempty"`
+}
+
+// holds reports whether the link points to a URL with the given deduplication key.
+func (l *link) holds(key string) bool {
+	return !l.Purged && dedupKey(l.URL, l.NormalizedURL) == key
+}
+
+func (l *link) model(id model.URLID) model.Link {
+	return model.Link{
+		ID:           id,
+		URL:          l.URL,
+		Title:        l.Title,
+		UserID:       l.UserID,
+		CreatedAt:    l.CreatedAt,
+		Clicks:       atomic.LoadInt64(&l.Clicks),
+		IsDeleted:    l.IsDeleted,
+		DeletedAt:    l.DeletedAt,
+		Interstitial: l.Interstitial,
+	}
 }
 
 // MemoryRepo is an in-memory implementation of Repo.
 // It is intended for tests and development; data is not persisted across process restarts.
 type MemoryRepo struct {
-	batchRemover
+	*batchRemover
 	mutex      sync.RWMutex
 	Store      []*link `json:"store"`
 	UsersCount int     `json:"usersCount"`
 	fname      string
 	logger     *zap.Logger
+	// ops holds the operations of the last operationTTL; they are not saved to the file
+	ops map[string]*model.Operation
 }
 
-// NewMemoryRepo performs a public package operation. Top-level handler/function.
+// NewMemoryRepo creates a repository kept in memory and loads the links saved in cfg.FileStoragePath.
 func NewMemoryRepo(cfg config.Config, logger *zap.Logger) (*MemoryRepo, error) {
-	res := &MemoryRepo{batchRemover: newBatchRemover(cfg), fname: cfg.FileStoragePath, logger: logger}
+	res := &MemoryRepo{fname: cfg.FileStoragePath, logger: logger, ops: make(map[string]*model.Operation)}
+	res.batchRemover = newBatchRemover(cfg, res.createOperation)
 	go res.deletionWorker(res.deleteImpl)
 
 	if cfg.FileStoragePath == "" {
@@ -75,8 +112,8 @@ func (m *MemoryRepo) dump() error {
 	return json.NewEncoder(file).Encode(m)
 }
 
-// Put is a method that provides public behavior for the corresponding type.
-func (m *MemoryRepo) Put(ctx context.Context, url string) (model.URLID, error) {
+// Put stores the link of the user, or returns a DuplicatedURLError with the id of the link holding the URL.
+func (m *MemoryRepo) Put(ctx context.Context, target model.LinkTarget) (model.URLID, error) {
 	userID, err := GetUserID(ctx)
 	if err != nil {
 		return 0, err
@@ -84,13 +121,14 @@ func (m *MemoryRepo) Put(ctx context.Context, url string) (model.URLID, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	key := dedupKey(target.URL, target.Normalized)
 	for i, v := range m.Store {
-		if v.URL == url {
-			return model.URLID(i), errs.NewDuplicatedURLError(url)
+		if v.holds(key) {
+			return model.URLID(i), errs.NewDuplicatedURLError(target.URL)
 		}
 	}
 
-	m.Store = append(m.Store, &link{URL: url, UserID: userID})
+	m.Store = append(m.Store, &link{URL: target.URL, NormalizedURL: target.Normalized, UserID: userID, CreatedAt: time.Now()})
 
 	err = m.dump()
 	if err != nil {
@@ -100,26 +138,35 @@ func (m *MemoryRepo) Put(ctx context.Context, url string) (model.URLID, error) {
 	return model.URLID(len(m.Store) - 1), nil
 }
 
-// Get is a method that provides public behavior for the corresponding type.
-func (m *MemoryRepo) Get(_ context.Context, id model.URLID) (string, error) {
+// Get returns the link unless it is deleted.
+func (m *MemoryRepo) Get(_ context.Context, id model.URLID) (model.Link, error) {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	intID := int(id.ID())
-	if intID >= len(m.Store) {
-		return "", errs.NewHTTPError(fmt.Sprintf("url for shortening %q doesn't exist", id), http.StatusNotFound)
+	if id.ID() >= uint64(len(m.Store)) {
+		return model.Link{}, linkNotFoundError(id)
 	}
 
-	res := m.Store[intID]
+	res := m.Store[id]
 	if res.IsDeleted {
-		return "", errs.NewHTTPError(fmt.Sprintf("url for shortening %q is deleted", id), http.StatusGone)
+		return model.Link{}, linkDeletedError(id)
 	}
 
-	return res.URL, nil
+	return res.model(id), nil
+}
+
+// CountClick counts a click of the link unless it is deleted. Clicks are saved to the file with the next change.
+func (m *MemoryRepo) CountClick(_ context.Context, id model.URLID) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if id.ID() < uint64(len(m.Store)) && !m.Store[id].IsDeleted {
+		atomic.AddInt64(&m.Store[id].Clicks, 1)
+	}
+	return nil
 }
 
-// BatchPut is a method that provides public behavior for the corresponding type.
-func (m *MemoryRepo) BatchPut(ctx context.Context, urls []string) ([]model.URLID, error) {
+func (m *MemoryRepo) BatchPut(ctx context.Context, targets []model.LinkTarget) ([]model.URLID, error) {
 	userID, err := GetUserID(ctx)
 	if err != nil {
 		return nil, err
@@ -130,72 +177,301 @@ func (m *MemoryRepo) BatchPut(ctx context.Context, urls []string) ([]model.URLID
 
 	var res []model.URLID
 outer:
-	for _, url := range urls {
+	for n, target := range targets {
+		key := dedupKey(target.URL, target.Normalized)
 		for i, v := range m.Store {
-			if v.URL == url {
+			if v.holds(key) {
 				res = append(res, model.URLID(i))
-				err = errors.Join(err, errs.NewDuplicatedURLError(url))
+				err = errors.Join(err, errs.NewDuplicatedItemError(target.URL, n))
 				continue outer
 			}
 		}
 
-		m.Store = append(m.Store, &link{URL: url, UserID: userID})
+		m.Store = append(m.Store, &link{URL: target.URL, NormalizedURL: target.Normalized, UserID: userID, CreatedAt: time.Now()})
 		res = append(res, model.URLID(len(m.Store)-1))
 	}
 
 	err1 := m.dump()
 	if err1 != nil {
-		return nil, err
+		return nil, err1
 	}
 
 	return res, err
 }
 
-func (m *MemoryRepo) deleteImpl(reqs []deleteLinkReq) {
+// deleteImpl applies a batch of deletion and restore requests.
+func (m *MemoryRepo) deleteImpl(_ context.Context, reqs []deleteLinkReq) []model.DeleteResult {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	now := time.Now()
+	deadline := m.restoreDeadline(now)
+	res := make([]model.DeleteResult, 0, len(reqs))
 	for _, req := range reqs {
-		if int(req.urlid) > len(m.Store) {
-			m.logger.Error("no such link")
+		var outcome model.DeleteOutcome
+		switch {
+		case req.urlid.ID() >= uint64(len(m.Store)):
+			m.logger.Error("no such link", req.logFields()...)
+			outcome = model.DeleteOutcomeNotFound
+		case m.Store[req.urlid].UserID != req.userID:
+			m.logger.Error("access denied", req.logFields()...)
+			outcome = model.DeleteOutcomeNotOwned
+		case req.restore:
+			outcome = m.Store[req.urlid].restore(deadline)
+		default:
+			l := m.Store[req.urlid]
+			if !l.IsDeleted {
+				l.IsDeleted, l.DeletedAt = true, &now
+			}
+			outcome = model.DeleteOutcomeDeleted
+		}
+		m.recordOutcome(req, outcome)
+		res = append(res, req.result(outcome))
+	}
+
+	err := m.dump()
+	if err != nil {
+		m.logger.Error("failed to save deletions", zap.Error(err))
+	}
+
+	return res
+}
+
+// recordOutcome sets the outcome of the request in its operation. The caller must hold the mutex.
+func (m *MemoryRepo) recordOutcome(req deleteLinkReq, outcome model.DeleteOutcome) {
+	if op, ok := m.ops[req.operationID]; ok {
+		op.Items[req.opItem].Outcome = outcome
+	}
+}
+
+func (m *MemoryRepo) createOperation(_ context.Context, op model.Operation) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for id, old := range m.ops {
+		if time.Since(old.CreatedAt) > operationTTL {
+			delete(m.ops, id)
+		}
+	}
+	m.ops[op.ID] = &op
+	return nil
+}
+
+// Operation returns the user's operation with the outcomes of its items.
+func (m *MemoryRepo) Operation(ctx context.Context, id string) (model.Operation, error) {
+	userID, err := GetUserID(ctx)
+	if err != nil {
+		return model.Operation{}, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	op, ok := m.ops[id]
+	if !ok || time.Since(op.CreatedAt) > operationTTL {
+		return model.Operation{}, operationNotFoundError(id)
+	}
+	if op.UserID != userID {
+		return model.Operation{}, operationNotOwnedError(id)
+	}
+	res := *op
+	res.Items = slices.Clone(op.Items)
+	return res, nil
+}
+
+// restore undoes the deletion of the link if it was deleted after the deadline.
+// Links deleted at an unknown time are not restored unless the deadline is zero.
+func (l *link) restore(deadline time.Time) model.DeleteOutcome {
+	switch {
+	case !l.IsDeleted:
+		return model.DeleteOutcomeNotDeleted
+	case l.Purged:
+		return model.DeleteOutcomeExpired
+	case !deadline.IsZero() && (l.DeletedAt == nil || l.DeletedAt.Before(deadline)):
+		return model.DeleteOutcomeExpired
+	}
+	l.IsDeleted, l.DeletedAt = false, nil
+	return model.DeleteOutcomeRestored
+}
+
+// Purge replaces links deleted before deletedBefore with tombstones. Links deleted at an unknown time are purged too.
+func (m *MemoryRepo) Purge(_ context.Context, deletedBefore time.Time) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var purged int64
+	for i, l := range m.Store {
+		if !l.IsDeleted || l.Purged || (l.DeletedAt != nil && !l.DeletedAt.Before(deletedBefore)) {
 			continue
 		}
+		m.Store[i] = &link{UserID: l.UserID, IsDeleted: true, DeletedAt: l.DeletedAt, Purged: true}
+		purged++
+	}
+	if purged == 0 {
+		return 0, nil
+	}
+
+	return purged, m.dump()
+}
+
+// Renormalize updates the normalized forms of the stored URLs that differ from normalize.
+// A link whose new form is already held by another link keeps its current form, so both stay reachable.
+func (m *MemoryRepo) Renormalize(_ context.Context, normalize func(url string) string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	keys := make(map[string]int, len(m.Store))
+	for i, l := range m.Store {
+		if !l.Purged {
+			keys[dedupKey(l.URL, l.NormalizedURL)] = i
+		}
+	}
 
-		l := m.Store[req.urlid]
-		if l.UserID != req.userID {
-			m.logger.Error("access denied")
+	var updated int64
+	for i, l := range m.Store {
+		if l.Purged {
+			continue
+		}
+		key, current := normalize(l.URL), dedupKey(l.URL, l.NormalizedURL)
+		if key == current {
 			continue
 		}
-		l.IsDeleted = true
+		if other, ok := keys[key]; ok {
+			m.logger.Warn("normalized url is held by another link", zap.Int("id", i), zap.Int("other", other), zap.String("url", l.URL))
+			continue
+		}
+		delete(keys, current)
+		keys[key] = i
+		l.NormalizedURL = key
+		updated++
 	}
+	if updated == 0 {
+		return 0, nil
+	}
+
+	return updated, m.dump()
 }
 
-// Ping is a method that provides public behavior for the corresponding type.
+// Ping always fails, as the memory storage has no database.
 func (m *MemoryRepo) Ping(__ context.Context) error {
 	return errNoDB
 }
 
-// UserUrls is a method that provides public behavior for the corresponding type.
-func (m *MemoryRepo) UserUrls(ctx context.Context) (map[model.URLID]string, error) {
+// UserUrls returns a page of the user's links in the order of the query.
+func (m *MemoryRepo) UserUrls(ctx context.Context, q model.LinkQuery) ([]model.Link, string, error) {
+	userID, err := GetUserID(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var after *linkCursor
+	if q.Cursor != "" {
+		cursor, err := parseLinkCursor(q.Cursor, q.Sort)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &cursor
+	}
+
+	direction := 1
+	if q.Desc {
+		direction = -1
+	}
+
+	m.mutex.RLock()
+	var res []model.Link
+	for i, v := range m.Store {
+		if v.Purged || v.UserID != userID || !strings.Contains(v.URL, q.Search) {
+			continue
+		}
+		item := v.model(model.URLID(i))
+		if after != nil && cursorOf(item).compare(*after, q.Sort)*direction <= 0 {
+			continue
+		}
+		res = append(res, item)
+	}
+	m.mutex.RUnlock()
+
+	slices.SortFunc(res, func(a, b model.Link) int {
+		return cursorOf(a).compare(cursorOf(b), q.Sort) * direction
+	})
+	if len(res) > q.Limit+1 {
+		res = res[:q.Limit+1]
+	}
+	res, next := nextCursor(res, q)
+	return res, next, nil
+}
+
+// ownLink returns the link with the given id if it belongs to the user of ctx.
+// The caller must hold the mutex.
+func (m *MemoryRepo) ownLink(ctx context.Context, id model.URLID) (*link, error) {
 	userID, err := GetUserID(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if id.ID() >= uint64(len(m.Store)) {
+		return nil, linkNotFoundError(id)
+	}
+	res := m.Store[id]
+	if res.UserID != userID {
+		return nil, linkNotOwnedError(id)
+	}
+	if res.Purged {
+		return nil, linkDeletedError(id)
+	}
+	return res, nil
+}
 
+// Link returns the user's link with its edit history.
+func (m *MemoryRepo) Link(ctx context.Context, id model.URLID) (model.Link, []model.LinkEdit, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	l, err := m.ownLink(ctx, id)
+	if err != nil {
+		return model.Link{}, nil, err
+	}
+	return l.model(id), slices.Clone(l.History), nil
+}
+
+// UpdateLink changes the user's link and records the edit in its history.
+func (m *MemoryRepo) UpdateLink(ctx context.Context, id model.URLID, upd model.LinkUpdate) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	res := make(map[model.URLID]string)
-	for i, v := range m.Store {
-		if v.UserID == userID {
-			res[model.URLID(i)] = v.URL
+	l, err := m.ownLink(ctx, id)
+	if err != nil {
+		return err
+	}
+	if l.IsDeleted {
+		return linkDeletedError(id)
+	}
+
+	updated, edit, changed := applyUpdate(l.model(id), upd, time.Now())
+	if !changed {
+		return nil
+	}
+	if updated.URL != l.URL {
+		key := dedupKey(updated.URL, upd.NormalizedURL)
+		if slices.ContainsFunc(m.Store, func(other *link) bool { return other != l && other.holds(key) }) {
+			return errs.NewDuplicatedURLError(updated.URL)
 		}
+		l.NormalizedURL = upd.NormalizedURL
 	}
 
-	return res, nil
+	l.URL, l.Title, l.Interstitial = updated.URL, updated.Title, updated.Interstitial
+	if edit != nil {
+		l.History = append(l.History, *edit)
+	}
+	return m.dump()
+}
+
+// DeleteLink deletes the user's link immediately.
+func (m *MemoryRepo) DeleteLink(ctx context.Context, id model.URLID) error {
+	return m.deleteNow(ctx, id, m.deleteImpl)
 }
 
-// CreateUser is a method that provides public behavior for the corresponding type.
+// CreateUser registers a new user and returns its id.
 func (m *MemoryRepo) CreateUser(_ context.Context) (int, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
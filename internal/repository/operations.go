@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/errs"
+	"net/http"
+	"time"
+)
+
+// operationTTL is how long the status of an operation is kept.
+const operationTTL = 24 * time.Hour
+
+func operationNotFoundError(id string) error {
+	return errs.NewHTTPError(fmt.Sprintf("operation %q doesn't exist", id), http.StatusNotFound)
+}
+
+func operationNotOwnedError(id string) error {
+	return errs.NewHTTPError(fmt.Sprintf("operation %q belongs to another user", id), http.StatusForbidden)
+}
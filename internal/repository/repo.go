@@ -6,27 +6,55 @@ import (
 	"github.com/kuznet1/urlshrt/internal/config"
 	"github.com/kuznet1/urlshrt/internal/model"
 	"go.uber.org/zap"
+	"time"
 )
 
 // Repo abstracts storage for short URLs.
 // Implementations must be safe for concurrent use where applicable and enforce per-user ownership.
-// Methods: Put/Get single URL, BatchPut, BatchDelete, URLsByUser and user management helpers.
+// Methods: Put/Get single URL, BatchPut, BatchDelete, BatchRestore with their Operation, UserUrls, per-link Link/UpdateLink/DeleteLink,
+// Purge and user management helpers.
+// Get only reads the link, while CountClick counts a click of it once the visit redirects to its destination.
+// Duplicated URLs are found by their normalized form, while redirects use the URLs as given.
+// Renormalize recomputes the normalized forms of stored URLs, such as those saved before normalization.
+// Purged links leave tombstones, so their ids are never reused and keep resolving to 410 Gone.
+// BatchPut reports duplicates as DuplicatedURLError with the index of the target; the memory repository
+// still stores the other targets, while the database one stores nothing.
 type Repo interface {
-	Put(ctx context.Context, url string) (model.URLID, error)
-	Get(ctx context.Context, id model.URLID) (string, error)
-	BatchPut(ctx context.Context, urls []string) ([]model.URLID, error)
+	Put(ctx context.Context, target model.LinkTarget) (model.URLID, error)
+	Get(ctx context.Context, id model.URLID) (model.Link, error)
+	CountClick(ctx context.Context, id model.URLID) error
+	BatchPut(ctx context.Context, targets []model.LinkTarget) ([]model.URLID, error)
 	CreateUser(ctx context.Context) (int, error)
-	UserUrls(ctx context.Context) (map[model.URLID]string, error)
-	BatchDelete(ctx context.Context, urlids []model.URLID) error
+	UserUrls(ctx context.Context, q model.LinkQuery) (links []model.Link, nextCursor string, err error)
+	Link(ctx context.Context, id model.URLID) (link model.Link, history []model.LinkEdit, err error)
+	UpdateLink(ctx context.Context, id model.URLID, upd model.LinkUpdate) error
+	DeleteLink(ctx context.Context, id model.URLID) error
+	BatchDelete(ctx context.Context, urlids []model.URLID) (operationID string, err error)
+	BatchRestore(ctx context.Context, urlids []model.URLID) (operationID string, err error)
+	Operation(ctx context.Context, id string) (model.Operation, error)
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	Renormalize(ctx context.Context, normalize func(url string) string) (int64, error)
+	OnDelete(listener DeleteListener)
+	WorkerAlive() error
 	Ping(ctx context.Context) error
 }
 
-// NewRepo performs a public package operation. Top-level handler/function.
+// NewRepo creates the database repository if cfg.DatabaseDSN is set and the memory one otherwise.
+// Calls of the returned repository are traced.
 func NewRepo(cfg config.Config, logger *zap.Logger) (Repo, error) {
 	if cfg.DatabaseDSN != "" {
-		return NewDBRepo(cfg, logger)
+		repo, err := NewDBRepo(cfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		return NewTracedRepo(repo, "postgresql"), nil
 	}
-	return NewMemoryRepo(cfg, logger)
+
+	repo, err := NewMemoryRepo(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return NewTracedRepo(repo, "memory"), nil
 }
 
 type key int
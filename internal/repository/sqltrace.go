@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/kuznet1/urlshrt/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// startQuery starts a client span of a SQL statement with the statement text in its attributes.
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation, _, _ := strings.Cut(query, " ")
+	return tracer.Start(ctx, "SQL "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(operation),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+// execTraced runs a statement in a span.
+func execTraced(ctx context.Context, q querier, query string, args ...any) (res sql.Result, err error) {
+	ctx, span := startQuery(ctx, query)
+	defer tracing.End(span, &err)
+	return q.ExecContext(ctx, query, args...)
+}
+
+// queryTraced runs a query in a span; the span ends before the rows are read.
+func queryTraced(ctx context.Context, q querier, query string, args ...any) (rows *sql.Rows, err error) {
+	ctx, span := startQuery(ctx, query)
+	defer tracing.End(span, &err)
+	return q.QueryContext(ctx, query, args...)
+}
+
+// scanTraced runs a single row query in a span and scans the row into dest.
+// An empty result is not recorded as a span error, as callers expect it.
+func scanTraced(ctx context.Context, q querier, query string, dest []any, args ...any) error {
+	ctx, span := startQuery(ctx, query)
+	err := q.QueryRowContext(ctx, query, args...).Scan(dest...)
+	spanErr := err
+	if errors.Is(spanErr, sql.ErrNoRows) {
+		spanErr = nil
+	}
+	tracing.End(span, &spanErr)
+	return err
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/kuznet1/urlshrt/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/kuznet1/urlshrt/internal/repository")
+
+// tracedRepo wraps every Repo call into a span named after the method.
+type tracedRepo struct {
+	Repo
+	storage attribute.KeyValue
+}
+
+// NewTracedRepo wraps repo to trace its calls; storage names the implementation in span attributes.
+func NewTracedRepo(repo Repo, storage string) Repo {
+	return &tracedRepo{Repo: repo, storage: attribute.String("repo.storage", storage)}
+}
+
+func (r *tracedRepo) start(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "Repo."+name, trace.WithAttributes(r.storage))
+}
+
+func (r *tracedRepo) Put(ctx context.Context, target model.LinkTarget) (urlid model.URLID, err error) {
+	ctx, span := r.start(ctx, "Put")
+	defer tracing.End(span, &err)
+	return r.Repo.Put(ctx, target)
+}
+
+func (r *tracedRepo) Get(ctx context.Context, id model.URLID) (link model.Link, err error) {
+	ctx, span := r.start(ctx, "Get")
+	defer tracing.End(span, &err)
+	return r.Repo.Get(ctx, id)
+}
+
+func (r *tracedRepo) CountClick(ctx context.Context, id model.URLID) (err error) {
+	ctx, span := r.start(ctx, "CountClick")
+	defer tracing.End(span, &err)
+	return r.Repo.CountClick(ctx, id)
+}
+
+func (r *tracedRepo) BatchPut(ctx context.Context, targets []model.LinkTarget) (urlids []model.URLID, err error) {
+	ctx, span := r.start(ctx, "BatchPut")
+	span.SetAttributes(attribute.Int("batch.size", len(targets)))
+	defer tracing.End(span, &err)
+	return r.Repo.BatchPut(ctx, targets)
+}
+
+func (r *tracedRepo) CreateUser(ctx context.Context) (userID int, err error) {
+	ctx, span := r.start(ctx, "CreateUser")
+	defer tracing.End(span, &err)
+	return r.Repo.CreateUser(ctx)
+}
+
+func (r *tracedRepo) UserUrls(ctx context.Context, q model.LinkQuery) (links []model.Link, next string, err error) {
+	ctx, span := r.start(ctx, "UserUrls")
+	defer tracing.End(span, &err)
+	return r.Repo.UserUrls(ctx, q)
+}
+
+func (r *tracedRepo) Link(ctx context.Context, id model.URLID) (link model.Link, history []model.LinkEdit, err error) {
+	ctx, span := r.start(ctx, "Link")
+	defer tracing.End(span, &err)
+	return r.Repo.Link(ctx, id)
+}
+
+func (r *tracedRepo) UpdateLink(ctx context.Context, id model.URLID, upd model.LinkUpdate) (err error) {
+	ctx, span := r.start(ctx, "UpdateLink")
+	defer tracing.End(span, &err)
+	return r.Repo.UpdateLink(ctx, id, upd)
+}
+
+func (r *tracedRepo) DeleteLink(ctx context.Context, id model.URLID) (err error) {
+	ctx, span := r.start(ctx, "DeleteLink")
+	defer tracing.End(span, &err)
+	return r.Repo.DeleteLink(ctx, id)
+}
+
+func (r *tracedRepo) BatchDelete(ctx context.Context, urlids []model.URLID) (operationID string, err error) {
+	ctx, span := r.start(ctx, "BatchDelete")
+	span.SetAttributes(attribute.Int("batch.size", len(urlids)))
+	defer tracing.End(span, &err)
+	return r.Repo.BatchDelete(ctx, urlids)
+}
+
+func (r *tracedRepo) BatchRestore(ctx context.Context, urlids []model.URLID) (operationID string, err error) {
+	ctx, span := r.start(ctx, "BatchRestore")
+	span.SetAttributes(attribute.Int("batch.size", len(urlids)))
+	defer tracing.End(span, &err)
+	return r.Repo.BatchRestore(ctx, urlids)
+}
+
+func (r *tracedRepo) Operation(ctx context.Context, id string) (op model.Operation, err error) {
+	ctx, span := r.start(ctx, "Operation")
+	defer tracing.End(span, &err)
+	return r.Repo.Operation(ctx, id)
+}
+
+func (r *tracedRepo) Purge(ctx context.Context, deletedBefore time.Time) (purged int64, err error) {
+	ctx, span := r.start(ctx, "Purge")
+	defer func() {
+		span.SetAttributes(attribute.Int64("purge.count", purged))
+		tracing.End(span, &err)
+	}()
+	return r.Repo.Purge(ctx, deletedBefore)
+}
+
+func (r *tracedRepo) Renormalize(ctx context.Context, normalize func(url string) string) (updated int64, err error) {
+	ctx, span := r.start(ctx, "Renormalize")
+	defer func() {
+		span.SetAttributes(attribute.Int64("renormalize.count", updated))
+		tracing.End(span, &err)
+	}()
+	return r.Repo.Renormalize(ctx, normalize)
+}
+
+func (r *tracedRepo) Ping(ctx context.Context) (err error) {
+	ctx, span := r.start(ctx, "Ping")
+	defer tracing.End(span, &err)
+	return r.Repo.Ping(ctx)
+}
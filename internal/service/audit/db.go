@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/errs"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DBAudit stores audit events in the audit_events table and queries them back.
+// The table is created by the repository migrations.
+type DBAudit struct {
+	db *sql.DB
+}
+
+// NewDBAudit connects to cfg.DatabaseDSN.
+func NewDBAudit(cfg config.Config) (*DBAudit, error) {
+	db, err := sql.Open("pgx", cfg.DatabaseDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return &DBAudit{db: db}, nil
+}
+
+// OnAuditEvt inserts the event into the audit table.
+// It implements the AuditSubscriber interface.
+func (a *DBAudit) OnAuditEvt(ctx context.Context, evt model.AuditEvent) error {
+	_, err := a.db.ExecContext(ctx,
+		"INSERT INTO audit_events (ts, action, user_id, url, outcome) VALUES ($1, $2, $3, $4, $5)",
+		evt.TS, evt.Action, evt.UserID, evt.URL, evt.Outcome,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+	return nil
+}
+
+// QueryAudit returns a page of events matching the query, the newest first.
+func (a *DBAudit) QueryAudit(ctx context.Context, q model.AuditQuery) (model.AuditPage, error) {
+	var conds []string
+	var args []any
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if q.Cursor != "" {
+		id, err := strconv.ParseInt(q.Cursor, 10, 64)
+		if err != nil {
+			return model.AuditPage{}, errs.NewHTTPError(fmt.Sprintf("invalid cursor %q", q.Cursor), http.StatusBadRequest)
+		}
+		where("id < $%d", id)
+	}
+	if q.UserID != nil {
+		where("user_id = $%d", *q.UserID)
+	}
+	if q.Action != "" {
+		where("action = $%d", q.Action)
+	}
+	if q.URL != "" {
+		where("strpos(url, $%d) > 0", q.URL)
+	}
+	if q.From != 0 {
+		where("ts >= $%d", q.From)
+	}
+	if q.To != 0 {
+		where("ts < $%d", q.To)
+	}
+
+	query := "SELECT id, ts, action, user_id, url, outcome FROM audit_events"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	limit := max(q.Limit, 1)
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d", len(args))
+
+	rows, err := a.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return model.AuditPage{}, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	res := model.AuditPage{Events: []model.AuditEvent{}}
+	var lastID int64
+	for rows.Next() {
+		if len(res.Events) == limit {
+			res.NextCursor = strconv.FormatInt(lastID, 10)
+			break
+		}
+
+		var evt model.AuditEvent
+		err = rows.Scan(&lastID, &evt.TS, &evt.Action, &evt.UserID, &evt.URL, &evt.Outcome)
+		if err != nil {
+			return model.AuditPage{}, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		res.Events = append(res.Events, evt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return model.AuditPage{}, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return res, nil
+}
+
+// Ping checks the database connection.
+func (a *DBAudit) Ping(ctx context.Context) error {
+	return a.db.PingContext(ctx)
+}
+
+// Close closes the database connection.
+func (a *DBAudit) Close() error {
+	return a.db.Close()
+}
@@ -2,41 +2,57 @@ package audit
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"github.com/kuznet1/urlshrt/internal/config"
 	"github.com/kuznet1/urlshrt/internal/model"
-	"os"
-	"time"
 )
 
-// FileAudit writes audit events to an io.Writer (typically a file).
+// FileAudit writes audit events to a file, one JSON object per line.
+// The file is rotated by size and/or daily according to the configuration.
+// It is safe for concurrent use.
 type FileAudit struct {
-	file *os.File
+	file *rotatingFile
+	enc  encoder
 }
 
-// NewFile performs a public package operation. Top-level handler/function.
-func NewFile(fname string) (*FileAudit, error) {
-	f, err := os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+// NewFile opens (or creates) cfg.AuditFile for appending audit events in cfg.AuditFormat.
+func NewFile(cfg config.Config) (*FileAudit, error) {
+	enc, err := newEncoder(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create audit logs file %s: %w", fname, err)
+		return nil, err
+	}
+
+	f, err := openRotatingFile(cfg.AuditFile, cfg.AuditFileMaxSize, cfg.AuditFileDaily, cfg.AuditFileBackups, cfg.AuditFileCompress)
+	if err != nil {
+		return nil, err
 	}
 	return &FileAudit{
 		file: f,
+		enc:  enc,
 	}, nil
 }
 
 // OnAuditEvt writes the event to the underlying writer in JSON format.
 // It implements the AuditSubscriber interface.
-func (a *FileAudit) OnAuditEvt(ctx context.Context, userID int, action model.AuditAction, url string) error {
-	return json.NewEncoder(a.file).Encode(model.AuditEvent{
-		TS:     time.Now().Unix(),
-		UserID: userID,
-		Action: action,
-		URL:    url,
-	})
+func (a *FileAudit) OnAuditEvt(ctx context.Context, evt model.AuditEvent) error {
+	data, err := a.enc.encode(evt)
+	if err != nil {
+		return err
+	}
+	_, err = a.file.Write(append(data, '\n'))
+	return err
+}
+
+// Reopen reopens the audit file by name; call it on SIGHUP after an external rotation.
+func (a *FileAudit) Reopen() error {
+	return a.file.Reopen()
+}
+
+// Ping checks that the audit file is open for writing.
+func (a *FileAudit) Ping(_ context.Context) error {
+	return a.file.Stat()
 }
 
-// Close is a method that provides public behavior for the corresponding type.
+// Close closes the file and waits for the compression and pruning of backups.
 func (a *FileAudit) Close() error {
 	return a.file.Close()
 }
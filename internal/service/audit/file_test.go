@@ -0,0 +1,212 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func countLines(t *testing.T, fname string) int {
+	f, err := os.Open(fname)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var r = bufio.NewReader(f)
+	if strings.HasSuffix(fname, compressedSuffix) {
+		gz, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		defer gz.Close()
+		r = bufio.NewReader(gz)
+	}
+
+	n := 0
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) == 0 {
+			break
+		}
+		var evt model.AuditEvent
+		require.NoError(t, json.Unmarshal(line, &evt))
+		n++
+		if err != nil {
+			break
+		}
+	}
+	return n
+}
+
+func TestFileAuditRotation(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewFile(config.Config{
+		AuditFile:         fname,
+		AuditFileMaxSize:  200,
+		AuditFileBackups:  2,
+		AuditFileCompress: true,
+	})
+	require.NoError(t, err)
+
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a.file.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	evt := model.AuditEvent{TS: 1, Action: model.ActionShorten, UserID: 1, URL: "http://example.com"}
+	for i := 0; i < 20; i++ {
+		require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	}
+	require.NoError(t, a.Close())
+
+	backups := listBackups(fname)
+	require.Len(t, backups, 2)
+	for _, name := range backups {
+		assert.True(t, strings.HasSuffix(name, compressedSuffix), name)
+		assert.Positive(t, countLines(t, name))
+	}
+
+	info, err := os.Stat(fname)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), int64(200))
+}
+
+func TestFileAuditDailyRotation(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewFile(config.Config{AuditFile: fname, AuditFileDaily: true})
+	require.NoError(t, err)
+
+	clock := time.Date(2026, 1, 1, 23, 59, 0, 0, time.UTC)
+	a.file.now = func() time.Time { return clock }
+	a.file.day = dayOf(clock)
+
+	evt := model.AuditEvent{TS: 1, Action: model.ActionFollow, URL: "http://example.com"}
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	clock = clock.Add(2 * time.Minute)
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	require.NoError(t, a.Close())
+
+	backups := listBackups(fname)
+	require.Len(t, backups, 1)
+	assert.Equal(t, fname+".20260101-235959.999", backups[0], "backups are stamped with the day of their records")
+	assert.Equal(t, 1, countLines(t, backups[0]))
+	assert.Equal(t, 1, countLines(t, fname))
+}
+
+func TestFileAuditDailyRotationEmptyFile(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewFile(config.Config{AuditFile: fname, AuditFileDaily: true})
+	require.NoError(t, err)
+
+	// the file is opened on the first day and stays empty until the second one
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	a.file.now = func() time.Time { return clock }
+	a.file.day = dayOf(clock)
+
+	evt := model.AuditEvent{TS: 1, Action: model.ActionFollow, URL: "http://example.com"}
+	clock = clock.AddDate(0, 0, 1)
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	clock = clock.Add(time.Hour)
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	assert.Empty(t, listBackups(fname), "records of the same day are not rotated")
+
+	clock = clock.AddDate(0, 0, 1)
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	require.NoError(t, a.Close())
+
+	backups := listBackups(fname)
+	require.Len(t, backups, 1)
+	assert.Equal(t, fname+".20260102-235959.999", backups[0])
+	assert.Equal(t, 2, countLines(t, backups[0]))
+	assert.Equal(t, 1, countLines(t, fname))
+}
+
+func TestFileAuditFailedRotation(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "audit.log")
+	a, err := NewFile(config.Config{AuditFile: fname, AuditFileMaxSize: 100})
+	require.NoError(t, err)
+
+	clock := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	a.file.now = func() time.Time { return clock }
+
+	// a directory in place of the backup makes the rename fail
+	backup := fname + "." + clock.Format(backupTimeFormat)
+	require.NoError(t, os.MkdirAll(filepath.Join(backup, "busy"), 0755))
+
+	evt := model.AuditEvent{TS: 1, Action: model.ActionShorten, URL: "http://example.com"}
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	err = a.OnAuditEvt(context.Background(), evt)
+	assert.ErrorContains(t, err, "failed to rotate audit logs file")
+	assert.Equal(t, 2, countLines(t, fname), "events are still written to the current file")
+	require.NoError(t, a.Ping(context.Background()))
+
+	require.NoError(t, os.RemoveAll(backup))
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	require.NoError(t, a.Close())
+	assert.Equal(t, 2, countLines(t, backup))
+	assert.Equal(t, 1, countLines(t, fname))
+}
+
+func TestFileAuditFailedReopen(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "audit.log")
+	a, err := NewFile(config.Config{AuditFile: fname})
+	require.NoError(t, err)
+
+	evt := model.AuditEvent{TS: 1, Action: model.ActionShorten, URL: "http://example.com"}
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+
+	moved := filepath.Join(dir, "audit.log.old")
+	require.NoError(t, os.Rename(fname, moved))
+	require.NoError(t, os.Mkdir(fname, 0755))
+	assert.Error(t, a.Reopen())
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	assert.Equal(t, 2, countLines(t, moved), "events are still written to the current file")
+
+	require.NoError(t, os.Remove(fname))
+	require.NoError(t, a.Reopen())
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	require.NoError(t, a.Close())
+	assert.Equal(t, 2, countLines(t, moved))
+	assert.Equal(t, 1, countLines(t, fname))
+}
+
+func TestFileAuditConcurrentWritesAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "audit.log")
+	a, err := NewFile(config.Config{AuditFile: fname})
+	require.NoError(t, err)
+
+	evt := model.AuditEvent{TS: 1, Action: model.ActionShorten, URL: strings.Repeat("x", 1000)}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				assert.NoError(t, a.OnAuditEvt(context.Background(), evt))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// emulate logrotate moving the file away before sending SIGHUP
+	moved := filepath.Join(dir, "audit.log.old")
+	require.NoError(t, os.Rename(fname, moved))
+	require.NoError(t, a.Reopen())
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	require.NoError(t, a.Close())
+
+	assert.Equal(t, 100, countLines(t, moved))
+	assert.Equal(t, 1, countLines(t, fname))
+}
@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/kuznet1/urlshrt/internal/random"
+	"time"
+)
+
+// Supported audit event formats.
+const (
+	// FormatPlain encodes model.AuditEvent as is.
+	FormatPlain = "plain"
+	// FormatCloudEvents wraps model.AuditEvent into a structured-mode CloudEvents 1.0 envelope.
+	FormatCloudEvents = "cloudevents"
+)
+
+// CloudEventTypePrefix prefixes the audit action to build the CloudEvents type attribute.
+const CloudEventTypePrefix = "com.github.kuznet1.urlshrt.audit."
+
+const (
+	plainContentType       = "application/json"
+	cloudEventsContentType = "application/cloudevents+json"
+)
+
+// CloudEvent is a structured-mode CloudEvents 1.0 envelope carrying an audit event.
+type CloudEvent struct {
+	SpecVersion     string           `json:"specversion"`
+	ID              string           `json:"id"`
+	Source          string           `json:"source"`
+	Type            string           `json:"type"`
+	Time            time.Time        `json:"time"`
+	DataContentType string           `json:"datacontenttype"`
+	Data            model.AuditEvent `json:"data"`
+}
+
+type encoder struct {
+	format string
+	source string
+}
+
+func newEncoder(cfg config.Config) (encoder, error) {
+	source := cfg.AuditSource
+	if source == "" {
+		source = cfg.ShortenerPrefix
+	}
+
+	switch cfg.AuditFormat {
+	case "", FormatPlain:
+		return encoder{format: FormatPlain}, nil
+	case FormatCloudEvents:
+		return encoder{format: FormatCloudEvents, source: source}, nil
+	default:
+		return encoder{}, fmt.Errorf("unknown audit format %q", cfg.AuditFormat)
+	}
+}
+
+func (e encoder) encode(evt model.AuditEvent) ([]byte, error) {
+	if e.format == FormatPlain {
+		return json.Marshal(evt)
+	}
+
+	return json.Marshal(CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              random.ID(),
+		Source:          e.source,
+		Type:            CloudEventTypePrefix + string(evt.Action),
+		Time:            time.Unix(evt.TS, 0).UTC(),
+		DataContentType: plainContentType,
+		Data:            evt,
+	})
+}
+
+func (e encoder) contentType() string {
+	if e.format == FormatCloudEvents {
+		return cloudEventsContentType
+	}
+	return plainContentType
+}
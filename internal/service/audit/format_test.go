@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestURLAuditCloudEvents(t *testing.T) {
+	var contentType string
+	var got CloudEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(body, &got))
+	}))
+	defer srv.Close()
+
+	a, err := NewURLAudit(config.Config{
+		AuditURL:        srv.URL,
+		AuditFormat:     FormatCloudEvents,
+		ShortenerPrefix: "http://localhost:8080",
+	})
+	require.NoError(t, err)
+
+	evt := model.AuditEvent{TS: 1700000000, Action: model.ActionFollow, UserID: 3, URL: "http://example.com"}
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+
+	assert.Equal(t, "application/cloudevents+json", contentType)
+	assert.Equal(t, "1.0", got.SpecVersion)
+	assert.Len(t, got.ID, 32)
+	assert.Equal(t, "http://localhost:8080", got.Source)
+	assert.Equal(t, "com.github.kuznet1.urlshrt.audit.follow", got.Type)
+	assert.Equal(t, time.Unix(1700000000, 0).UTC(), got.Time)
+	assert.Equal(t, evt, got.Data)
+}
+
+func TestFileAuditPlain(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "audit.log")
+	a, err := NewFile(config.Config{AuditFile: fname})
+	require.NoError(t, err)
+
+	evt := model.AuditEvent{TS: 1700000000, Action: model.ActionShorten, UserID: 3, URL: "http://example.com"}
+	require.NoError(t, a.OnAuditEvt(context.Background(), evt))
+	require.NoError(t, a.Close())
+
+	data, err := os.ReadFile(fname)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ts":1700000000,"action":"shorten","user_id":3,"url":"http://example.com"}`+"\n", string(data))
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := NewURLAudit(config.Config{AuditFormat: "xml"})
+	assert.Error(t, err)
+}
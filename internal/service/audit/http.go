@@ -3,46 +3,86 @@ package audit
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/config"
 	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/kuznet1/urlshrt/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
-	"time"
 )
 
+var tracer = otel.Tracer("github.com/kuznet1/urlshrt/internal/service/audit")
+
 // URLAudit forwards audit events to a remote HTTP endpoint.
 type URLAudit struct {
 	url string
+	enc encoder
 }
 
-// NewURLAudit creates an HTTP audit subscriber that POSTs JSON events to the configured URL.
-func NewURLAudit(url string) *URLAudit {
-	return &URLAudit{
-		url: url,
+// NewURLAudit creates an HTTP audit subscriber that POSTs events in cfg.AuditFormat to cfg.AuditURL.
+// CloudEvents are sent in structured content mode.
+func NewURLAudit(cfg config.Config) (*URLAudit, error) {
+	enc, err := newEncoder(cfg)
+	if err != nil {
+		return nil, err
 	}
+
+	return &URLAudit{
+		url: cfg.AuditURL,
+		enc: enc,
+	}, nil
 }
 
 // OnAuditEvt sends the given event to the configured HTTP endpoint.
 // It implements the AuditSubscriber interface.
-func (a *URLAudit) OnAuditEvt(ctx context.Context, userID int, action model.AuditAction, url string) error {
-	data, err := json.Marshal(model.AuditEvent{
-		TS:     time.Now().Unix(),
-		UserID: userID,
-		Action: action,
-		URL:    url,
-	})
+// The request is traced and carries the W3C trace context of ctx.
+func (a *URLAudit) OnAuditEvt(ctx context.Context, evt model.AuditEvent) (err error) {
+	ctx, span := tracer.Start(ctx, "POST audit",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(http.MethodPost),
+			semconv.URLFull(a.url),
+			attribute.String("audit.action", string(evt.Action)),
+		),
+	)
+	defer tracing.End(span, &err)
+
+	data, err := a.enc.encode(evt)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewBuffer(data))
 	if err != nil {
 		return err
 	}
+	req.Header.Set("Content-Type", a.enc.contentType())
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	return nil
+}
 
+// Ping checks that the audit endpoint accepts connections. Any HTTP response counts as success,
+// as the endpoint is not required to support HEAD requests.
+func (a *URLAudit) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, a.url, nil)
+	if err != nil {
+		return err
+	}
 	resp, err := http.DefaultClient.Do(req)
-	if err == nil {
-		defer resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("audit endpoint is unreachable: %w", err)
 	}
-	return err
+	resp.Body.Close()
+	return nil
 }
@@ -0,0 +1,399 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/errs"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type indexEntry struct {
+	offset int64
+	size   int
+	ts     int64
+	userID int
+	action model.AuditAction
+}
+
+// FileReader queries audit events stored by FileAudit in a JSONL file.
+// It incrementally indexes the file by event time, user and action, so only
+// new lines are parsed on each query and URL filters read just the candidate lines.
+// The index is rebuilt when the file is rotated. Rotated backups, plain or gzipped, are not indexed:
+// queries reaching past the events of the file stream them from the newest to the oldest,
+// keeping in memory no more events than fit into the page.
+type FileReader struct {
+	mu      sync.Mutex
+	fname   string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	gen     int
+	entries []indexEntry
+	byUser  map[int][]int
+}
+
+// NewFileReader creates a reader over the audit file produced by FileAudit.
+func NewFileReader(fname string) *FileReader {
+	return &FileReader{fname: fname}
+}
+
+// QueryAudit returns a page of events matching the query, the newest first.
+func (r *FileReader) QueryAudit(_ context.Context, q model.AuditQuery) (model.AuditPage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.refresh()
+	if err != nil {
+		return model.AuditPage{}, err
+	}
+
+	page := &auditPage{limit: max(q.Limit, 1), res: model.AuditPage{Events: []model.AuditEvent{}}}
+	if stamp, line, ok, err := parseBackupCursor(q.Cursor); ok || err != nil {
+		if err != nil {
+			return model.AuditPage{}, err
+		}
+		err = r.queryBackups(q, page, stamp, line)
+		return page.res, err
+	}
+
+	end := len(r.entries)
+	if q.Cursor != "" {
+		end, err = r.parseCursor(q.Cursor)
+		if err != nil {
+			return model.AuditPage{}, err
+		}
+	}
+
+	full, err := r.queryFile(q, page, end)
+	if err != nil || full {
+		return page.res, err
+	}
+	err = r.queryBackups(q, page, "", 0)
+	return page.res, err
+}
+
+// auditPage collects a page of events from the newest to the oldest.
+type auditPage struct {
+	limit int
+	res   model.AuditPage
+	// last is the cursor continuing after the last collected event
+	last string
+}
+
+// add collects the event found at the cursor. It reports false once the page is full,
+// setting the next cursor as there are more events.
+func (p *auditPage) add(evt model.AuditEvent, cursor string) bool {
+	if len(p.res.Events) == p.limit {
+		p.res.NextCursor = p.last
+		return false
+	}
+	p.res.Events = append(p.res.Events, evt)
+	p.last = cursor
+	return true
+}
+
+// queryFile collects the matching events of the file at index positions below end.
+// It reports whether the page is full.
+func (r *FileReader) queryFile(q model.AuditQuery, page *auditPage, end int) (bool, error) {
+	next := r.positions(q.UserID, end)
+	for pos, ok := next(); ok; pos, ok = next() {
+		e := r.entries[pos]
+		if !matchIndexed(q, e.ts, e.userID, e.action) {
+			continue
+		}
+
+		evt, err := r.read(e)
+		if err != nil {
+			return false, err
+		}
+		if !strings.Contains(evt.URL, q.URL) {
+			continue
+		}
+
+		if !page.add(evt, fmt.Sprintf("%d.%d", r.gen, pos)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// positions returns an iterator over index positions below end, from the newest to the oldest.
+func (r *FileReader) positions(userID *int, end int) func() (int, bool) {
+	if userID == nil {
+		pos := end
+		return func() (int, bool) {
+			pos--
+			return pos, pos >= 0
+		}
+	}
+
+	list := r.byUser[*userID]
+	i := sort.SearchInts(list, end)
+	return func() (int, bool) {
+		i--
+		if i < 0 {
+			return 0, false
+		}
+		return list[i], true
+	}
+}
+
+func (r *FileReader) parseCursor(cursor string) (int, error) {
+	genStr, posStr, _ := strings.Cut(cursor, ".")
+	gen, err1 := strconv.Atoi(genStr)
+	pos, err2 := strconv.Atoi(posStr)
+	if err1 != nil || err2 != nil || pos < 0 {
+		return 0, errs.NewHTTPError(fmt.Sprintf("invalid cursor %q", cursor), http.StatusBadRequest)
+	}
+	if gen != r.gen || pos > len(r.entries) {
+		return 0, errs.NewHTTPError("cursor expired: audit file was rotated", http.StatusBadRequest)
+	}
+	return pos, nil
+}
+
+// refresh indexes lines appended since the last call and starts over if the file was replaced or truncated.
+func (r *FileReader) refresh() error {
+	info, err := os.Stat(r.fname)
+	if errors.Is(err, os.ErrNotExist) {
+		r.reset()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat audit file %s: %w", r.fname, err)
+	}
+
+	if r.file == nil || !os.SameFile(r.info, info) || info.Size() < r.offset {
+		r.reset()
+		r.file, err = os.Open(r.fname)
+		if err != nil {
+			return fmt.Errorf("failed to open audit file %s: %w", r.fname, err)
+		}
+	}
+	r.info = info
+
+	reader := bufio.NewReader(io.NewSectionReader(r.file, r.offset, info.Size()-r.offset))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// an incomplete last line is indexed once it is fully written
+			return nil
+		}
+
+		evt, err := decodeLine(line)
+		if err == nil {
+			pos := len(r.entries)
+			r.entries = append(r.entries, indexEntry{
+				offset: r.offset,
+				size:   len(line),
+				ts:     evt.TS,
+				userID: evt.UserID,
+				action: evt.Action,
+			})
+			r.byUser[evt.UserID] = append(r.byUser[evt.UserID], pos)
+		}
+		r.offset += int64(len(line))
+	}
+}
+
+func (r *FileReader) reset() {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	r.info = nil
+	r.offset = 0
+	r.entries = nil
+	r.byUser = make(map[int][]int)
+	r.gen++
+}
+
+func (r *FileReader) read(e indexEntry) (model.AuditEvent, error) {
+	buf := make([]byte, e.size)
+	_, err := r.file.ReadAt(buf, e.offset)
+	if err != nil {
+		return model.AuditEvent{}, fmt.Errorf("failed to read audit file %s: %w", r.fname, err)
+	}
+	return decodeLine(buf)
+}
+
+// Close closes the indexed audit file.
+func (r *FileReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// decodeLine parses an audit line written in either the plain or the CloudEvents format.
+func decodeLine(line []byte) (model.AuditEvent, error) {
+	var ce CloudEvent
+	err := json.Unmarshal(line, &ce)
+	if err != nil {
+		return model.AuditEvent{}, err
+	}
+	if ce.SpecVersion != "" {
+		return ce.Data, nil
+	}
+
+	var evt model.AuditEvent
+	err = json.Unmarshal(line, &evt)
+	return evt, err
+}
+
+func matchIndexed(q model.AuditQuery, ts int64, userID int, action model.AuditAction) bool {
+	if q.UserID != nil && *q.UserID != userID {
+		return false
+	}
+	if q.Action != "" && q.Action != action {
+		return false
+	}
+	if q.From != 0 && ts < q.From {
+		return false
+	}
+	if q.To != 0 && ts >= q.To {
+		return false
+	}
+	return true
+}
+
+// backupCursorPrefix starts the cursors of pages continuing in a backup; they hold the timestamp
+// of the backup and the line to continue before, which stay valid when the backup is compressed.
+const backupCursorPrefix = "b."
+
+func backupCursor(stamp string, line int) string {
+	return fmt.Sprintf("%s%s.%d", backupCursorPrefix, stamp, line)
+}
+
+// parseBackupCursor reports whether the cursor continues in a backup and parses it.
+func parseBackupCursor(cursor string) (stamp string, line int, ok bool, err error) {
+	rest, ok := strings.CutPrefix(cursor, backupCursorPrefix)
+	if !ok {
+		return "", 0, false, nil
+	}
+	i := strings.LastIndex(rest, ".")
+	if i >= 0 {
+		stamp = rest[:i]
+		line, err = strconv.Atoi(rest[i+1:])
+	}
+	if i < 0 || err != nil || line < 0 {
+		return "", 0, true, errs.NewHTTPError(fmt.Sprintf("invalid cursor %q", cursor), http.StatusBadRequest)
+	}
+	if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+		return "", 0, true, errs.NewHTTPError(fmt.Sprintf("invalid cursor %q", cursor), http.StatusBadRequest)
+	}
+	return stamp, line, true, nil
+}
+
+// backupMatch is a matching event of a backup with the number of its line.
+type backupMatch struct {
+	evt  model.AuditEvent
+	line int
+}
+
+// queryBackups collects the matching events of the backups older than the backup stamped before,
+// and of the lines of that backup preceding line; all backups are queried if before is empty.
+func (r *FileReader) queryBackups(q model.AuditQuery, page *auditPage, before string, line int) error {
+	backups := listBackups(r.fname)
+	plain := make(map[string]bool, len(backups))
+	for _, name := range backups {
+		plain[name] = true
+	}
+	for i := len(backups) - 1; i >= 0; i-- {
+		name := backups[i]
+		base, compressed := strings.CutSuffix(name, compressedSuffix)
+		if compressed && plain[base] {
+			// the backup is being compressed, its plain copy is complete
+			continue
+		}
+		stamp := strings.TrimPrefix(base, r.fname+".")
+
+		end := -1
+		if before != "" {
+			if stamp > before {
+				continue
+			}
+			if stamp == before {
+				end = line
+			}
+		}
+
+		matches, err := r.scanBackup(name, q, end, page.limit-len(page.res.Events)+1)
+		if err != nil {
+			return err
+		}
+		for j := len(matches) - 1; j >= 0; j-- {
+			if !page.add(matches[j].evt, backupCursor(stamp, matches[j].line)) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// scanBackup streams the backup and returns up to keep of its last events matching the query
+// among the lines before end, or among all lines if end is negative.
+func (r *FileReader) scanBackup(name string, q model.AuditQuery, end int, keep int) ([]backupMatch, error) {
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) && !strings.HasSuffix(name, compressedSuffix) {
+		// compressed since it was listed
+		name += compressedSuffix
+		file, err = os.Open(name)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		// pruned since it was listed
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file %s: %w", name, err)
+	}
+	defer file.Close()
+
+	var src io.Reader = file
+	if strings.HasSuffix(name, compressedSuffix) {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit file %s: %w", name, err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	var res []backupMatch
+	reader := bufio.NewReader(src)
+	for n := 0; end < 0 || n < end; n++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit file %s: %w", name, err)
+		}
+
+		evt, err := decodeLine(line)
+		if err != nil || !matchIndexed(q, evt.TS, evt.UserID, evt.Action) || !strings.Contains(evt.URL, q.URL) {
+			continue
+		}
+		res = append(res, backupMatch{evt: evt, line: n})
+		if len(res) > keep {
+			res = slices.Delete(res, 0, 1)
+		}
+	}
+	return res, nil
+}
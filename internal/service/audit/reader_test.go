@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileReaderQuery(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "audit.log")
+	plain, err := NewFile(config.Config{AuditFile: fname})
+	require.NoError(t, err)
+	defer plain.Close()
+	ce, err := NewFile(config.Config{AuditFile: fname, AuditFormat: FormatCloudEvents})
+	require.NoError(t, err)
+	defer ce.Close()
+
+	events := []model.AuditEvent{
+		{TS: 100, Action: model.ActionShorten, UserID: 1, URL: "http://example.com/a"},
+		{TS: 200, Action: model.ActionFollow, UserID: 2, URL: "http://example.com/a"},
+		{TS: 300, Action: model.ActionShorten, UserID: 1, URL: "http://foo.bar"},
+		{TS: 400, Action: model.ActionShorten, UserID: 1, URL: "http://example.com/b"},
+	}
+	for i, evt := range events {
+		sink := plain
+		if i%2 == 1 {
+			sink = ce
+		}
+		require.NoError(t, sink.OnAuditEvt(context.Background(), evt))
+	}
+
+	reader := NewFileReader(fname)
+	defer reader.Close()
+	ctx := context.Background()
+	user := 1
+
+	t.Run("all", func(t *testing.T) {
+		page, err := reader.QueryAudit(ctx, model.AuditQuery{Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []model.AuditEvent{events[3], events[2], events[1], events[0]}, page.Events)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		page, err := reader.QueryAudit(ctx, model.AuditQuery{UserID: &user, Action: model.ActionShorten, URL: "example.com", From: 100, To: 400, Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []model.AuditEvent{events[0]}, page.Events)
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		page, err := reader.QueryAudit(ctx, model.AuditQuery{UserID: &user, Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []model.AuditEvent{events[3], events[2]}, page.Events)
+		require.NotEmpty(t, page.NextCursor)
+
+		page, err = reader.QueryAudit(ctx, model.AuditQuery{UserID: &user, Limit: 2, Cursor: page.NextCursor})
+		require.NoError(t, err)
+		assert.Equal(t, []model.AuditEvent{events[0]}, page.Events)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("new events are indexed", func(t *testing.T) {
+		evt := model.AuditEvent{TS: 500, Action: model.ActionUserCreated, UserID: 3}
+		require.NoError(t, plain.OnAuditEvt(ctx, evt))
+		page, err := reader.QueryAudit(ctx, model.AuditQuery{Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []model.AuditEvent{evt}, page.Events)
+	})
+
+	t.Run("rotated file", func(t *testing.T) {
+		page, err := reader.QueryAudit(ctx, model.AuditQuery{Limit: 1})
+		require.NoError(t, err)
+		require.NoError(t, os.Rename(fname, fname+".old"))
+		require.NoError(t, plain.Reopen())
+
+		_, err = reader.QueryAudit(ctx, model.AuditQuery{Limit: 1, Cursor: page.NextCursor})
+		assert.Error(t, err)
+
+		page, err = reader.QueryAudit(ctx, model.AuditQuery{Limit: 1})
+		require.NoError(t, err)
+		assert.Empty(t, page.Events)
+	})
+}
+
+func TestFileReaderBackups(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			fname := filepath.Join(t.TempDir(), "audit.log")
+			a, err := NewFile(config.Config{AuditFile: fname, AuditFileMaxSize: 200, AuditFileCompress: compress})
+			require.NoError(t, err)
+			defer a.Close()
+			clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			a.file.now = func() time.Time {
+				clock = clock.Add(time.Second)
+				return clock
+			}
+
+			reader := NewFileReader(fname)
+			defer reader.Close()
+			ctx := context.Background()
+
+			var events []model.AuditEvent
+			for i := 0; i < 10; i++ {
+				evt := model.AuditEvent{TS: int64(i), Action: model.ActionShorten, UserID: i % 2, URL: "http://example.com"}
+				require.NoError(t, a.OnAuditEvt(ctx, evt))
+				events = append(events, evt)
+
+				// query between writes, so the reader follows the rotations
+				_, err = reader.QueryAudit(ctx, model.AuditQuery{Limit: 1})
+				require.NoError(t, err)
+			}
+			a.file.wg.Wait()
+			backups := listBackups(fname)
+			require.NotEmpty(t, backups)
+			for _, name := range backups {
+				assert.Equal(t, compress, strings.HasSuffix(name, compressedSuffix), name)
+			}
+
+			page, err := reader.QueryAudit(ctx, model.AuditQuery{Limit: 100})
+			require.NoError(t, err)
+			slices.Reverse(events)
+			assert.Equal(t, events, page.Events)
+			assert.Empty(t, page.NextCursor)
+
+			user := 1
+			page, err = reader.QueryAudit(ctx, model.AuditQuery{UserID: &user, Limit: 2})
+			require.NoError(t, err)
+			assert.Equal(t, []model.AuditEvent{events[0], events[2]}, page.Events)
+			page, err = reader.QueryAudit(ctx, model.AuditQuery{UserID: &user, Limit: 10, Cursor: page.NextCursor})
+			require.NoError(t, err)
+			assert.Equal(t, []model.AuditEvent{events[4], events[6], events[8]}, page.Events)
+
+			// page by page through the file and every backup
+			var got []model.AuditEvent
+			cursor := ""
+			for {
+				page, err = reader.QueryAudit(ctx, model.AuditQuery{Limit: 3, Cursor: cursor})
+				require.NoError(t, err)
+				got = append(got, page.Events...)
+				if page.NextCursor == "" {
+					break
+				}
+				cursor = page.NextCursor
+			}
+			assert.Equal(t, events, got)
+		})
+	}
+}
+
+func TestFileReaderBackupCursor(t *testing.T) {
+	reader := NewFileReader(filepath.Join(t.TempDir(), "audit.log"))
+	defer reader.Close()
+	for _, cursor := range []string{"b.", "b.20260101-000000.000", "b.20260101.5", "b.20260101-000000.000.-1"} {
+		_, err := reader.QueryAudit(context.Background(), model.AuditQuery{Limit: 1, Cursor: cursor})
+		assert.ErrorContains(t, err, "invalid cursor", cursor)
+	}
+}
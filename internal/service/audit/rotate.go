@@ -0,0 +1,275 @@
+package audit
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	backupTimeFormat = "20060102-150405.000"
+	compressedSuffix = ".gz"
+)
+
+// rotatingFile is an append-only file that is rotated by size and/or daily.
+// Rotated files are renamed to <name>.<timestamp>, optionally gzipped,
+// and only the newest backups are kept. It is safe for concurrent use.
+type rotatingFile struct {
+	mu      sync.Mutex
+	fname   string
+	maxSize int64
+	daily   bool
+	backups int
+	gzip    bool
+	file    *os.File
+	size    int64
+	day     string
+	now     func() time.Time
+
+	// cleanup serializes compression and pruning of backups that run in the background.
+	cleanup sync.Mutex
+	wg      sync.WaitGroup
+}
+
+func openRotatingFile(fname string, maxSize int64, daily bool, backups int, compress bool) (*rotatingFile, error) {
+	f := &rotatingFile{
+		fname:   fname,
+		maxSize: maxSize,
+		daily:   daily,
+		backups: backups,
+		gzip:    compress,
+		now:     time.Now,
+	}
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit logs file %s: %w", f.fname, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit logs file %s: %w", f.fname, err)
+	}
+
+	f.file = file
+	f.size = info.Size()
+	f.day = dayOf(f.now())
+	if f.size > 0 {
+		f.day = dayOf(info.ModTime())
+	}
+	return nil
+}
+
+// Write appends p to the file as a single write, rotating the file beforehand if needed.
+// A failed rotation keeps the current file, so p is still written and the rotation error is returned with the result.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	if f.size == 0 {
+		// the records of an empty file start now, whenever it was opened
+		f.day = dayOf(f.now())
+	}
+
+	var rotateErr error
+	if f.shouldRotate(len(p)) {
+		rotateErr = f.rotate()
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, errors.Join(rotateErr, err)
+}
+
+func (f *rotatingFile) shouldRotate(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.maxSize > 0 && f.size+int64(n) > f.maxSize {
+		return true
+	}
+	return f.daily && dayOf(f.now()) != f.day
+}
+
+// rotate renames the file to a backup and opens a new one. The current file is closed only
+// once the new one is open; if the rotation fails, writing continues in the current file under its name.
+func (f *rotatingFile) rotate() error {
+	backup := f.fname + "." + f.backupTime().Format(backupTimeFormat)
+	err := os.Rename(f.fname, backup)
+	if err != nil {
+		return fmt.Errorf("failed to rotate audit logs file %s: %w", f.fname, err)
+	}
+
+	current := f.file
+	err = f.open()
+	if err != nil {
+		return errors.Join(err, os.Rename(backup, f.fname))
+	}
+
+	err = current.Close()
+	if err != nil {
+		err = fmt.Errorf("failed to close rotated audit logs file %s: %w", backup, err)
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.cleanup.Lock()
+		defer f.cleanup.Unlock()
+		if f.gzip {
+			// a failed compression leaves the plain backup in place, which is still readable
+			_ = compressFile(backup)
+		}
+		f.prune()
+	}()
+	return err
+}
+
+// backupTime returns the timestamp of the next backup. A daily backup is stamped
+// with the last moment of the day of its records rather than the time of the rotation.
+func (f *rotatingFile) backupTime() time.Time {
+	now := f.now()
+	if !f.daily || dayOf(now) == f.day {
+		return now
+	}
+	day, err := time.ParseInLocation(time.DateOnly, f.day, now.Location())
+	if err != nil {
+		return now
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Millisecond)
+}
+
+// prune removes the oldest backups exceeding the configured limit.
+func (f *rotatingFile) prune() {
+	if f.backups <= 0 {
+		return
+	}
+
+	backups := listBackups(f.fname)
+	if len(backups) <= f.backups {
+		return
+	}
+	for _, name := range backups[:len(backups)-f.backups] {
+		os.Remove(name)
+	}
+}
+
+// Reopen closes and reopens the file by name. It lets external tools such as logrotate
+// move the file away and have the writer continue in a fresh file.
+// If the file cannot be reopened, writing continues in the current one.
+func (f *rotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current := f.file
+	err := f.open()
+	if err != nil || current == nil {
+		return err
+	}
+
+	err = current.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close audit logs file %s: %w", f.fname, err)
+	}
+	return nil
+}
+
+// Stat checks that the file is open and still accessible.
+func (f *rotatingFile) Stat() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return fmt.Errorf("audit logs file %s is closed", f.fname)
+	}
+	_, err := f.file.Stat()
+	if err != nil {
+		return fmt.Errorf("audit logs file %s is not accessible: %w", f.fname, err)
+	}
+	return nil
+}
+
+// Close closes the file and waits for background compression to finish.
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.wg.Wait()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// listBackups returns rotated files of fname ordered from the oldest to the newest.
+func listBackups(fname string) []string {
+	matches, err := filepath.Glob(fname + ".*")
+	if err != nil {
+		return nil
+	}
+
+	var res []string
+	for _, name := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, fname+"."), compressedSuffix)
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			res = append(res, name)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return strings.TrimSuffix(res[i], compressedSuffix) < strings.TrimSuffix(res[j], compressedSuffix)
+	})
+	return res
+}
+
+func compressFile(fname string) error {
+	src, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(fname+compressedSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err1 := dst.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(fname + compressedSuffix)
+		return err
+	}
+
+	return os.Remove(fname)
+}
+
+func dayOf(t time.Time) string {
+	return t.Format(time.DateOnly)
+}
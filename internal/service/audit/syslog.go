@@ -0,0 +1,203 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// syslogPriority is facility 13 (log audit) with severity 5 (notice).
+	syslogPriority = 13*8 + 5
+	// syslogSDID is the structured data id of audit events; 32473 is the enterprise number reserved for documentation.
+	syslogSDID = "audit@32473"
+	nilValue   = "-"
+)
+
+// SyslogAudit sends audit events as RFC 5424 messages over UDP, TCP or a unix socket.
+// Stream transports use octet-counting framing (RFC 6587). A broken connection is
+// re-established on the next event. It is safe for concurrent use.
+type SyslogAudit struct {
+	mu       sync.Mutex
+	network  string
+	addr     string
+	stream   bool
+	conn     net.Conn
+	hostname string
+	appName  string
+	procID   string
+	enc      encoder
+}
+
+// NewSyslogAudit creates a syslog subscriber for cfg.AuditSyslog address given as
+// udp://host:port, tcp://host:port, unix:///path (stream) or unixgram:///path.
+// The connection is established lazily on the first event.
+func NewSyslogAudit(cfg config.Config) (*SyslogAudit, error) {
+	enc, err := newEncoder(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(cfg.AuditSyslog)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address %q: %w", cfg.AuditSyslog, err)
+	}
+
+	res := &SyslogAudit{
+		network: u.Scheme,
+		enc:     enc,
+		appName: headerField(cfg.AuditSyslogTag, 48),
+		procID:  strconv.Itoa(os.Getpid()),
+	}
+
+	switch u.Scheme {
+	case "udp", "tcp":
+		res.addr = u.Host
+	case "unix", "unixgram":
+		res.addr = u.Path
+	default:
+		return nil, fmt.Errorf("unsupported syslog network %q", u.Scheme)
+	}
+	res.stream = u.Scheme == "tcp" || u.Scheme == "unix"
+
+	hostname, _ := os.Hostname()
+	res.hostname = headerField(hostname, 255)
+
+	return res, nil
+}
+
+// OnAuditEvt sends the event to the syslog server.
+// It implements the AuditSubscriber interface.
+func (a *SyslogAudit) OnAuditEvt(ctx context.Context, evt model.AuditEvent) error {
+	msg, err := a.format(evt)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err = a.write(ctx, msg)
+	if err != nil {
+		// the server may have dropped the previous connection, retry once on a fresh one
+		err = a.write(ctx, msg)
+	}
+	return err
+}
+
+// Ping connects to the syslog server unless already connected.
+// Datagram transports only report errors detected locally, such as a missing socket.
+func (a *SyslogAudit) Ping(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.connect(ctx)
+}
+
+// connect dials the server if there is no connection; a.mu must be held.
+func (a *SyslogAudit) connect(ctx context.Context) error {
+	if a.conn != nil {
+		return nil
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, a.network, a.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog %s://%s: %w", a.network, a.addr, err)
+	}
+	a.conn = conn
+	return nil
+}
+
+func (a *SyslogAudit) write(ctx context.Context, msg []byte) error {
+	err := a.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		a.conn.SetWriteDeadline(deadline)
+	} else {
+		a.conn.SetWriteDeadline(time.Time{})
+	}
+
+	_, err = a.conn.Write(msg)
+	if err != nil {
+		a.conn.Close()
+		a.conn = nil
+		return fmt.Errorf("failed to send audit event to syslog: %w", err)
+	}
+	return nil
+}
+
+// format builds an RFC 5424 message, framed with its length for stream transports.
+func (a *SyslogAudit) format(evt model.AuditEvent) ([]byte, error) {
+	body, err := a.enc.encode(evt)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %s %s ",
+		syslogPriority,
+		time.Unix(evt.TS, 0).UTC().Format(time.RFC3339),
+		a.hostname,
+		a.appName,
+		a.procID,
+		headerField(string(evt.Action), 32),
+	)
+	fmt.Fprintf(&buf, `[%s action="%s" user_id="%d" url="%s"`,
+		syslogSDID, sdEscape(string(evt.Action)), evt.UserID, sdEscape(evt.URL))
+	if evt.Outcome != "" {
+		fmt.Fprintf(&buf, ` outcome="%s"`, sdEscape(evt.Outcome))
+	}
+	buf.WriteString("] ")
+	buf.Write(body)
+
+	if !a.stream {
+		return buf.Bytes(), nil
+	}
+	return append([]byte(strconv.Itoa(buf.Len())+" "), buf.Bytes()...), nil
+}
+
+// Close closes the connection to the syslog server, if any.
+func (a *SyslogAudit) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn == nil {
+		return nil
+	}
+	err := a.conn.Close()
+	a.conn = nil
+	return err
+}
+
+// headerField makes s a valid RFC 5424 header field: printable ASCII without spaces, limited in length.
+func headerField(s string, maxLen int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return nilValue
+	}
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	return s
+}
+
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func sdEscape(s string) string {
+	return sdEscaper.Replace(s)
+}
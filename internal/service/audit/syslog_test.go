@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var syslogRe = regexp.MustCompile(`^<109>1 2023-11-14T22:13:20Z \S+ urlshrt \d+ delete_applied \[audit@32473 action="delete_applied" user_id="7" url="http://x/\\"q\\]" outcome="deleted"\] \{.*\}$`)
+
+var syslogEvt = model.AuditEvent{
+	TS:      1700000000,
+	Action:  model.ActionDeleteApplied,
+	UserID:  7,
+	URL:     `http://x/"q]`,
+	Outcome: string(model.DeleteOutcomeDeleted),
+}
+
+func newTestSyslog(t *testing.T, addr string) *SyslogAudit {
+	a, err := NewSyslogAudit(config.Config{AuditSyslog: addr, AuditSyslogTag: "urlshrt"})
+	require.NoError(t, err)
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	a := newTestSyslog(t, "udp://"+conn.LocalAddr().String())
+	require.NoError(t, a.OnAuditEvt(context.Background(), syslogEvt))
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Regexp(t, syslogRe, string(buf[:n]))
+}
+
+// readFramed reads octet-counted messages from every accepted connection,
+// closing each connection after the first message to force reconnects.
+func readFramed(l net.Listener) <-chan string {
+	msgs := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			size, err := r.ReadString(' ')
+			if err == nil {
+				n, _ := strconv.Atoi(strings.TrimSpace(size))
+				buf := make([]byte, n)
+				_, err = io.ReadFull(r, buf)
+				if err == nil {
+					msgs <- string(buf)
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return msgs
+}
+
+func TestSyslogStreamReconnect(t *testing.T) {
+	tests := []struct {
+		name   string
+		listen func(t *testing.T) (net.Listener, string)
+	}{
+		{"tcp", func(t *testing.T) (net.Listener, string) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			return l, "tcp://" + l.Addr().String()
+		}},
+		{"unix", func(t *testing.T) (net.Listener, string) {
+			path := filepath.Join(t.TempDir(), "syslog.sock")
+			l, err := net.Listen("unix", path)
+			require.NoError(t, err)
+			return l, "unix://" + path
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l, addr := test.listen(t)
+			defer l.Close()
+			msgs := readFramed(l)
+			a := newTestSyslog(t, addr)
+
+			require.NoError(t, a.OnAuditEvt(context.Background(), syslogEvt))
+			assert.Regexp(t, syslogRe, <-msgs)
+
+			// the server has dropped the connection: writes into it eventually fail and trigger a reconnect
+			deadline := time.After(5 * time.Second)
+			for {
+				a.OnAuditEvt(context.Background(), syslogEvt)
+				select {
+				case msg := <-msgs:
+					assert.Regexp(t, syslogRe, msg)
+					return
+				case <-deadline:
+					t.Fatal("no message after reconnect")
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+		})
+	}
+}
+
+func TestSyslogBadAddress(t *testing.T) {
+	_, err := NewSyslogAudit(config.Config{AuditSyslog: "http://localhost"})
+	assert.Error(t, err)
+}
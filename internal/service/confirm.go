@@ -0,0 +1,55 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/kuznet1/urlshrt/internal/random"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// confirmTokenTTL is how long the continue link of a preview page stays valid.
+const confirmTokenTTL = 10 * time.Minute
+
+// newConfirmKey returns the key signing confirm tokens: the secret key of the auth tokens,
+// or a random key of the process if none is configured, as tokens signed with an empty key could be forged.
+// Confirm tokens signed with a random key do not survive a restart, which costs a visitor one more preview page.
+func newConfirmKey(secretKey string) []byte {
+	if secretKey != "" {
+		return []byte(secretKey)
+	}
+	return random.Bytes(sha256.BlockSize)
+}
+
+// confirmURL returns the continue link of the preview page of the link, valid for confirmTokenTTL.
+func (svc *Service) confirmURL(urlid model.URLID, now time.Time) string {
+	expiry := strconv.FormatInt(now.Add(confirmTokenTTL).Unix(), 36)
+	token := expiry + "." + svc.confirmSignature(urlid, expiry)
+	return urlid.AsURL(svc.cfg.ShortenerPrefix) + "?confirm=" + url.QueryEscape(token)
+}
+
+// validConfirmToken reports whether the token was issued by confirmURL for the link and has not expired,
+// so the visit may skip the interstitial page forced for the link.
+func (svc *Service) validConfirmToken(urlid model.URLID, token string, now time.Time) bool {
+	expiry, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(expiry, 36, 64)
+	if err != nil || now.Unix() > unix {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(svc.confirmSignature(urlid, expiry)))
+}
+
+// confirmSignature signs the link id and the expiry with the confirm key.
+// The signed message differs from any JWT, so confirm tokens and auth tokens are not interchangeable.
+func (svc *Service) confirmSignature(urlid model.URLID, expiry string) string {
+	mac := hmac.New(sha256.New, svc.confirmKey)
+	mac.Write([]byte("preview:" + urlid.String() + ":" + expiry))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
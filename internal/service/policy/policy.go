@@ -0,0 +1,236 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"go.uber.org/zap"
+	"golang.org/x/net/idna"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy decides which destinations links may point to.
+//
+// Domains of the allow and deny lists match themselves and their subdomains, while entries
+// starting with "*." match only the subdomains. If the allow list is not empty, other domains are rejected.
+// The blocklist file holds one domain or URL pattern per line; patterns contain "://" and match
+// the whole URL, with "*" standing for any characters. Empty lines and lines starting with "#" are ignored.
+// The blocklist is reloaded by Watch when the file changes.
+type Policy struct {
+	allow    []string
+	deny     []string
+	fname    string
+	interval time.Duration
+	logger   *zap.Logger
+
+	mu       sync.RWMutex
+	info     os.FileInfo
+	domains  []string
+	patterns []*regexp.Regexp
+}
+
+// NewPolicy creates the policy from cfg, loading the blocklist file if it is configured.
+func NewPolicy(cfg config.Config, logger *zap.Logger) (*Policy, error) {
+	p := &Policy{
+		allow:    parseDomains(cfg.AllowedDomains),
+		deny:     parseDomains(cfg.DeniedDomains),
+		fname:    cfg.BlocklistFile,
+		interval: cfg.BlocklistReloadInterval,
+		logger:   logger,
+	}
+	if p.fname == "" {
+		return p, nil
+	}
+
+	_, err := p.reload()
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Check returns an error describing why links must not point to the URL, or nil if they may.
+func (p *Policy) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	host := normalizeDomain(u.Hostname())
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if matchDomain(p.domains, host) {
+		return fmt.Errorf("domain %q is blocklisted", host)
+	}
+	for _, pattern := range p.patterns {
+		if pattern.MatchString(rawURL) {
+			return fmt.Errorf("url matches blocklisted pattern %q", pattern.String())
+		}
+	}
+
+	if matchDomain(p.deny, host) {
+		return fmt.Errorf("domain %q is denied", host)
+	}
+	if len(p.allow) > 0 && !matchDomain(p.allow, host) {
+		return fmt.Errorf("domain %q is not allowed", host)
+	}
+	return nil
+}
+
+// Watch reloads the blocklist file every interval if it was changed, until ctx is done.
+// A broken file is reported and the previous blocklist stays in effect.
+func (p *Policy) Watch(ctx context.Context) {
+	if p.fname == "" || p.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := p.reload()
+		if err != nil {
+			p.logger.Error("failed to reload blocklist", zap.Error(err))
+			continue
+		}
+		if reloaded {
+			p.mu.RLock()
+			p.logger.Info("blocklist reloaded", zap.Int("domains", len(p.domains)), zap.Int("patterns", len(p.patterns)))
+			p.mu.RUnlock()
+		}
+	}
+}
+
+// reload reads the blocklist file unless it is unchanged since the last read.
+func (p *Policy) reload() (bool, error) {
+	info, err := os.Stat(p.fname)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat blocklist file %s: %w", p.fname, err)
+	}
+
+	p.mu.RLock()
+	unchanged := p.info != nil && os.SameFile(p.info, info) && p.info.ModTime().Equal(info.ModTime()) && p.info.Size() == info.Size()
+	p.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	domains, patterns, err := readBlocklist(p.fname)
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.info, p.domains, p.patterns = info, domains, patterns
+	return true, nil
+}
+
+func readBlocklist(fname string) ([]string, []*regexp.Regexp, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open blocklist file %s: %w", fname, err)
+	}
+	defer file.Close()
+
+	var domains []string
+	var patterns []*regexp.Regexp
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !strings.Contains(line, "://") {
+			domains = append(domains, normalizeDomain(line))
+			continue
+		}
+		pattern, err := compilePattern(line)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid pattern at %s:%d: %w", fname, n, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read blocklist file %s: %w", fname, err)
+	}
+	return domains, patterns, nil
+}
+
+// compilePattern turns a URL pattern into a regexp matching whole URLs, with "*" matching any characters.
+// The scheme and the host of the pattern are matched case-insensitively.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	scheme, rest, _ := strings.Cut(pattern, "://")
+	host, path, hasPath := strings.Cut(rest, "/")
+	if scheme == "" || host == "" {
+		return nil, errors.New("pattern must have a scheme and a host")
+	}
+
+	expr := "(?i:" + quoteWildcards(scheme+"://"+host) + ")"
+	if hasPath {
+		expr += "/" + quoteWildcards(path)
+	}
+	return regexp.Compile("^" + expr + "$")
+}
+
+func quoteWildcards(s string) string {
+	parts := strings.Split(s, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return strings.Join(parts, ".*")
+}
+
+func parseDomains(domains []string) []string {
+	var res []string
+	for _, domain := range domains {
+		domain = normalizeDomain(domain)
+		if domain != "" {
+			res = append(res, domain)
+		}
+	}
+	return res
+}
+
+// normalizeDomain lowercases the domain, converting internationalized names to punycode
+// as the shortened URLs have them.
+func normalizeDomain(domain string) string {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	ascii, err := idna.Lookup.ToASCII(strings.TrimPrefix(domain, "*."))
+	if err != nil {
+		return domain
+	}
+	if strings.HasPrefix(domain, "*.") {
+		return "*." + ascii
+	}
+	return ascii
+}
+
+// matchDomain reports whether the host matches one of the domains.
+func matchDomain(domains []string, host string) bool {
+	for _, domain := range domains {
+		if suffix, ok := strings.CutPrefix(domain, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
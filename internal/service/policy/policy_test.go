@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"context"
+	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "blocklist.txt")
+	blocklist := "# phishing\n\nevil.com\nhttps://docs.example.org/login*\n*://*.pages.dev/paypal/*\n"
+	require.NoError(t, os.WriteFile(fname, []byte(blocklist), 0o644))
+
+	p, err := NewPolicy(config.Config{
+		AllowedDomains: []string{"example.org", "pages.dev", "evil.com", "xn--e1afmkfd.xn--p1ai"},
+		DeniedDomains:  []string{"*.Internal.Example.org", "bad.example.org"},
+		BlocklistFile:  fname,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	tests := []struct {
+		url     string
+		message string
+	}{
+		{"https://example.org/", ""},
+		{"https://www.example.org/path", ""},
+		{"https://internal.example.org/", ""},
+		{"https://host.internal.example.org/", `domain "host.internal.example.org" is denied`},
+		{"https://bad.example.org/", `domain "bad.example.org" is denied`},
+		{"https://sub.bad.example.org/", `domain "sub.bad.example.org" is denied`},
+		{"https://notexample.org/", `domain "notexample.org" is not allowed`},
+		{"http://EVIL.com/", `domain "evil.com" is blocklisted`},
+		{"http://www.evil.com/", `domain "www.evil.com" is blocklisted`},
+		{"https://docs.example.org/", ""},
+		{"https://DOCS.example.org/login?next=/", `url matches blocklisted pattern`},
+		{"http://docs.example.org/login", ""},
+		{"http://scam.pages.dev/paypal/verify", `url matches blocklisted pattern`},
+		{"http://scam.pages.dev/PayPal/verify", ""},
+		{"http://xn--e1afmkfd.xn--p1ai/", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			err := p.Check(test.url)
+			if test.message == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.message)
+		})
+	}
+
+	t.Run("no lists", func(t *testing.T) {
+		p, err := NewPolicy(config.Config{}, zap.NewNop())
+		require.NoError(t, err)
+		assert.NoError(t, p.Check("https://anything.example/"))
+	})
+
+	t.Run("missing blocklist", func(t *testing.T) {
+		_, err := NewPolicy(config.Config{BlocklistFile: filepath.Join(t.TempDir(), "missing.txt")}, zap.NewNop())
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		fname := filepath.Join(t.TempDir(), "blocklist.txt")
+		require.NoError(t, os.WriteFile(fname, []byte("evil.com\nhttps:///login\n"), 0o644))
+		_, err := NewPolicy(config.Config{BlocklistFile: fname}, zap.NewNop())
+		assert.ErrorContains(t, err, "blocklist.txt:2")
+	})
+}
+
+func TestWatch(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(fname, []byte("evil.com\n"), 0o644))
+	p, err := NewPolicy(config.Config{BlocklistFile: fname, BlocklistReloadInterval: 10 * time.Millisecond}, zap.NewNop())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Watch(ctx)
+
+	require.Error(t, p.Check("http://evil.com/"))
+	require.NoError(t, p.Check("http://worse.com/"))
+
+	require.NoError(t, os.WriteFile(fname, []byte("worse.com\n"), 0o644))
+	require.Eventually(t, func() bool { return p.Check("http://worse.com/") != nil }, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, p.Check("http://evil.com/"))
+
+	// a broken file keeps the previous blocklist in effect
+	require.NoError(t, os.WriteFile(fname, []byte("://\n"), 0o644))
+	time.Sleep(50 * time.Millisecond)
+	assert.Error(t, p.Check("http://worse.com/"))
+}
@@ -2,12 +2,25 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/kuznet1/urlshrt/internal/config"
+	"github.com/kuznet1/urlshrt/internal/errs"
+	"github.com/kuznet1/urlshrt/internal/logger"
 	"github.com/kuznet1/urlshrt/internal/model"
+	"github.com/kuznet1/urlshrt/internal/qrcode"
 	"github.com/kuznet1/urlshrt/internal/repository"
+	"github.com/kuznet1/urlshrt/internal/tracing"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
+var tracer = otel.Tracer("github.com/kuznet1/urlshrt/internal/service")
+
 // Service contains the application business logic atop the storage layer.
 // It coordinates repository operations and publishes audit events.
 type Service struct {
@@ -15,108 +28,607 @@ type Service struct {
 	cfg    config.Config
 	logger *zap.Logger
 	subs   []AuditSubscriber
+	reader AuditReader
+	policy DestinationPolicy
+	// confirmKey signs the continue links of preview pages
+	confirmKey []byte
 }
 
-// AuditSubscriber is notified about URL creation events.
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+	defaultLinksPageSize = 100
+	maxLinksPageSize     = 1000
+	maxTitleLength       = 256
+	maxQRSize            = 2048
+	maxQRMargin          = 16
+)
+
+// AuditSubscriber is notified about URL creation, following, deletion and user registration events.
 // Implementations may forward events to files, HTTP endpoints, or external systems.
 type AuditSubscriber interface {
-	OnAuditEvt(ctx context.Context, userID int, action model.AuditAction, url string) error
+	OnAuditEvt(ctx context.Context, evt model.AuditEvent) error
+}
+
+// AuditReader looks up stored audit events for the admin audit API.
+type AuditReader interface {
+	QueryAudit(ctx context.Context, q model.AuditQuery) (model.AuditPage, error)
+}
+
+// DestinationPolicy decides which destinations links may point to.
+// Check returns the reason a URL is forbidden, or nil if it is allowed.
+type DestinationPolicy interface {
+	Check(url string) error
 }
 
 // NewService constructs a Service with the given repository and configuration.
-func NewService(repo repository.Repo, cfg config.Config, logger *zap.Logger) Service {
-	return Service{repo: repo, cfg: cfg, logger: logger}
+// The service listens to the repository deletion worker to report applied deletions.
+func NewService(repo repository.Repo, cfg config.Config, logger *zap.Logger) *Service {
+	svc := &Service{repo: repo, cfg: cfg, logger: logger, confirmKey: newConfirmKey(cfg.SecretKey)}
+	repo.OnDelete(svc.onDeleted)
+	return svc
+}
+
+// CreateUser registers a new user and returns its id.
+func (svc *Service) CreateUser(ctx context.Context) (userID int, err error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateUser")
+	defer tracing.End(span, &err)
+
+	userID, err = svc.repo.CreateUser(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	svc.fireEvt(ctx, model.AuditEvent{UserID: userID, Action: model.ActionUserCreated})
+	return userID, nil
 }
 
 // Shorten validates and stores a single URL and returns its short identifier.
-// If the URL already exists for the user, a DuplicatedURLError is returned.
-func (svc *Service) Shorten(ctx context.Context, url string) (string, error) {
-	urlid, err := svc.repo.Put(ctx, url)
+// If the URL or another URL with the same normalized form already exists, a DuplicatedURLError is returned
+// along with the identifier of the existing link.
+func (svc *Service) Shorten(ctx context.Context, url string) (shortURL string, err error) {
+	ctx, span := tracer.Start(ctx, "Service.Shorten")
+	defer tracing.End(span, &err)
+
+	url, err = svc.checkURL(url)
+	if err != nil {
+		return "", err
+	}
+	err = svc.checkDestination(ctx, url, http.StatusForbidden)
+	if err != nil {
+		return "", err
+	}
+
+	urlid, err := svc.repo.Put(ctx, model.LinkTarget{URL: url, Normalized: svc.normalizeURL(url)})
 	svc.fire(ctx, model.ActionShorten, url)
 	return urlid.AsURL(svc.cfg.ShortenerPrefix), err
 }
 
 // BatchShorten stores multiple URLs at once and returns their identifiers in the same order.
-// Errors for individual items are combined; duplicates are reported as DuplicatedURLError.
-func (svc *Service) BatchShorten(ctx context.Context, urls []string) ([]string, error) {
+// Invalid URLs and then URLs forbidden by the destination policy are reported together as a BatchError
+// and nothing is stored;
+// errors for individual items are combined; duplicates are reported as DuplicatedURLError.
+// The URLs stored despite the duplicates are still reported as batch shorten events.
+func (svc *Service) BatchShorten(ctx context.Context, urls []string) (shortURLs []string, err error) {
+	ctx, span := tracer.Start(ctx, "Service.BatchShorten")
+	defer tracing.End(span, &err)
+
 	if len(urls) == 0 {
 		return []string{}, nil
 	}
 
-	urlids, err := svc.repo.BatchPut(ctx, urls)
+	err = svc.checkBatch(len(urls))
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]model.LinkTarget, 0, len(urls))
+	var invalid errs.BatchError
+	for i, url := range urls {
+		url, err := svc.checkURL(url)
+		if err != nil {
+			invalid.Items = append(invalid.Items, errs.ItemError{Index: i, Message: err.Error()})
+		}
+		targets = append(targets, model.LinkTarget{URL: url, Normalized: svc.normalizeURL(url)})
+	}
+	if len(invalid.Items) > 0 {
+		return nil, &invalid
+	}
+	blocked := errs.BatchError{Code: http.StatusForbidden}
+	for i, target := range targets {
+		err := svc.checkDestination(ctx, target.URL, http.StatusForbidden)
+		if err != nil {
+			blocked.Items = append(blocked.Items, errs.ItemError{Index: i, Message: err.Error()})
+		}
+	}
+	if len(blocked.Items) > 0 {
+		return nil, &blocked
+	}
+
+	urlids, err := svc.repo.BatchPut(ctx, targets)
 	if err != nil {
+		if urlids != nil {
+			duplicated := duplicatedItems(err)
+			for i, target := range targets {
+				if !duplicated[i] {
+					svc.fire(ctx, model.ActionBatchShorten, target.URL)
+				}
+			}
+		}
 		return nil, err
 	}
 
 	var res []string
-	for _, urlid := range urlids {
+	for i, urlid := range urlids {
+		svc.fire(ctx, model.ActionBatchShorten, targets[i].URL)
 		res = append(res, urlid.AsURL(svc.cfg.ShortenerPrefix))
 	}
 
 	return res, nil
 }
 
+// duplicatedItems returns the indexes of the batch items reported as duplicates in the joined err.
+func duplicatedItems(err error) map[int]bool {
+	res := make(map[int]bool)
+	items := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		items = joined.Unwrap()
+	}
+	for _, item := range items {
+		var dup *errs.DuplicatedURLError
+		if errors.As(item, &dup) {
+			res[dup.Index] = true
+		}
+	}
+	return res
+}
+
 // BatchDelete removes the given short ids that belong to the current user.
 // The actual deletion strategy (immediate vs. batched) depends on the repository implementation.
-func (svc *Service) BatchDelete(ctx context.Context, ids []string) error {
+// The returned operation id identifies the outcomes of the deletions, see Operation.
+func (svc *Service) BatchDelete(ctx context.Context, ids []string) (operationID string, err error) {
+	ctx, span := tracer.Start(ctx, "Service.BatchDelete")
+	defer tracing.End(span, &err)
+
+	err = svc.checkBatch(len(ids))
+	if err != nil {
+		return "", err
+	}
+
+	urlids, err := parseURLIDs(ids)
+	if err != nil {
+		return "", err
+	}
+
+	for _, urlid := range urlids {
+		svc.fire(ctx, model.ActionDeleteRequested, urlid.AsURL(svc.cfg.ShortenerPrefix))
+	}
+
+	return svc.repo.BatchDelete(ctx, urlids)
+}
+
+// BatchRestore restores the given deleted short ids that belong to the current user.
+// Like deletions, restores are applied in batches; links deleted longer than the configured
+// restore window ago stay deleted.
+func (svc *Service) BatchRestore(ctx context.Context, ids []string) (operationID string, err error) {
+	ctx, span := tracer.Start(ctx, "Service.BatchRestore")
+	defer tracing.End(span, &err)
+
+	err = svc.checkBatch(len(ids))
+	if err != nil {
+		return "", err
+	}
+
+	urlids, err := parseURLIDs(ids)
+	if err != nil {
+		return "", err
+	}
+
+	for _, urlid := range urlids {
+		svc.fire(ctx, model.ActionRestoreRequested, urlid.AsURL(svc.cfg.ShortenerPrefix))
+	}
+
+	return svc.repo.BatchRestore(ctx, urlids)
+}
+
+// Operation returns the progress of the user's deletion or restore operation.
+func (svc *Service) Operation(ctx context.Context, id string) (resp model.OperationResponse, err error) {
+	ctx, span := tracer.Start(ctx, "Service.Operation")
+	defer tracing.End(span, &err)
+
+	op, err := svc.repo.Operation(ctx, id)
+	if err != nil {
+		return model.OperationResponse{}, err
+	}
+
+	resp = model.OperationResponse{ID: op.ID, Kind: "delete", Status: "pending", CreatedAt: op.CreatedAt}
+	if op.Restore {
+		resp.Kind = "restore"
+	}
+	if op.Done() {
+		resp.Status = "done"
+	}
+	for _, item := range op.Items {
+		outcome := string(item.Outcome)
+		if outcome == "" {
+			outcome = "pending"
+		}
+		resp.Items = append(resp.Items, model.OperationResponseItem{
+			ID:       item.URLID.String(),
+			ShortURL: item.URLID.AsURL(svc.cfg.ShortenerPrefix),
+			Outcome:  outcome,
+		})
+	}
+	return resp, nil
+}
+
+func parseURLIDs(ids []string) ([]model.URLID, error) {
 	var urlids []model.URLID
 	for _, id := range ids {
 		urlid, err := model.ParseURLID(id)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		urlids = append(urlids, urlid)
 	}
+	return urlids, nil
+}
 
-	return svc.repo.BatchDelete(ctx, urlids)
+// checkBatch rejects batches with more items than the configured limit.
+func (svc *Service) checkBatch(size int) error {
+	if svc.cfg.MaxBatchSize > 0 && size > svc.cfg.MaxBatchSize {
+		msg := fmt.Sprintf("batch has %d items, the limit is %d items", size, svc.cfg.MaxBatchSize)
+		return errs.NewHTTPError(msg, http.StatusBadRequest)
+	}
+	return nil
 }
 
-// UserUrls returns a list of the user's URLs along with their absolute short forms.
-func (svc *Service) UserUrls(ctx context.Context) ([]model.UrlsByUserResponseItem, error) {
-	urlids, err := svc.repo.UserUrls(ctx)
+// UserUrls returns a page of the user's links along with their absolute short forms
+// and the cursor of the next page, which is empty on the last page.
+// Links are ordered by creation time unless another order is requested.
+func (svc *Service) UserUrls(ctx context.Context, q model.LinkQuery) (urls []model.UrlsByUserResponseItem, next string, err error) {
+	ctx, span := tracer.Start(ctx, "Service.UserUrls")
+	defer tracing.End(span, &err)
+
+	if q.Sort == "" {
+		q.Sort = model.LinkSortCreated
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultLinksPageSize
+	}
+	q.Limit = min(q.Limit, maxLinksPageSize)
+
+	links, next, err := svc.repo.UserUrls(ctx, q)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	res := []model.UrlsByUserResponseItem{}
-	for urlid, url := range urlids {
+	for _, link := range links {
 		res = append(res, model.UrlsByUserResponseItem{
-			OriginalURL: url,
-			ShortURL:    urlid.AsURL(svc.cfg.ShortenerPrefix),
+			OriginalURL: link.URL,
+			ShortURL:    link.ID.AsURL(svc.cfg.ShortenerPrefix),
+			Title:       link.Title,
+			CreatedAt:   link.CreatedAt,
+			Clicks:      link.Clicks,
+			IsDeleted:   link.IsDeleted,
+			DeletedAt:   link.DeletedAt,
 		})
 	}
 
-	return res, nil
+	return res, next, nil
 }
 
-// Lengthen resolves a short identifier back to the original URL.
-func (svc *Service) Lengthen(ctx context.Context, id string) (string, error) {
+// Link returns the details and the edit history of the user's link.
+func (svc *Service) Link(ctx context.Context, id string) (resp model.LinkResponse, err error) {
+	ctx, span := tracer.Start(ctx, "Service.Link")
+	defer tracing.End(span, &err)
+
 	urlid, err := model.ParseURLID(id)
 	if err != nil {
-		return "", err
+		return model.LinkResponse{}, err
+	}
+
+	link, history, err := svc.repo.Link(ctx, urlid)
+	if err != nil {
+		return model.LinkResponse{}, err
+	}
+
+	if history == nil {
+		history = []model.LinkEdit{}
+	}
+	return model.LinkResponse{
+		OriginalURL:  link.URL,
+		ShortURL:     link.ID.AsURL(svc.cfg.ShortenerPrefix),
+		Title:        link.Title,
+		CreatedAt:    link.CreatedAt,
+		Clicks:       link.Clicks,
+		IsDeleted:    link.IsDeleted,
+		DeletedAt:    link.DeletedAt,
+		Interstitial: link.Interstitial,
+		History:      history,
+	}, nil
+}
+
+// UpdateLink changes the destination URL, the title or the interstitial flag of the user's link
+// and returns the updated link.
+// Changing the URL to one already shortened results in a DuplicatedURLError.
+func (svc *Service) UpdateLink(ctx context.Context, id string, upd model.LinkUpdate) (resp model.LinkResponse, err error) {
+	ctx, span := tracer.Start(ctx, "Service.UpdateLink")
+	defer tracing.End(span, &err)
+
+	urlid, err := model.ParseURLID(id)
+	if err != nil {
+		return model.LinkResponse{}, err
+	}
+
+	if upd.URL == nil && upd.Title == nil && upd.Interstitial == nil {
+		return model.LinkResponse{}, errs.NewHTTPError("nothing to update: url, title or interstitial expected", http.StatusBadRequest)
+	}
+	if upd.URL != nil {
+		url, err := svc.checkURL(*upd.URL)
+		if err != nil {
+			return model.LinkResponse{}, err
+		}
+		err = svc.checkDestination(ctx, url, http.StatusForbidden)
+		if err != nil {
+			return model.LinkResponse{}, err
+		}
+		upd.URL = &url
+		upd.NormalizedURL = svc.normalizeURL(url)
+	}
+	if upd.Title != nil && len(*upd.Title) > maxTitleLength {
+		msg := fmt.Sprintf("title is %d bytes long, the limit is %d bytes", len(*upd.Title), maxTitleLength)
+		return model.LinkResponse{}, errs.NewHTTPError(msg, http.StatusBadRequest)
+	}
+
+	err = svc.repo.UpdateLink(ctx, urlid, upd)
+	if err != nil {
+		return model.LinkResponse{}, err
+	}
+
+	resp, err = svc.Link(ctx, id)
+	if err != nil {
+		return model.LinkResponse{}, err
+	}
+	svc.fire(ctx, model.ActionEdit, resp.OriginalURL)
+	return resp, nil
+}
+
+// DeleteLink deletes the user's link immediately, unlike BatchDelete.
+func (svc *Service) DeleteLink(ctx context.Context, id string) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.DeleteLink")
+	defer tracing.End(span, &err)
+
+	urlid, err := model.ParseURLID(id)
+	if err != nil {
+		return err
+	}
+
+	svc.fire(ctx, model.ActionDeleteRequested, urlid.AsURL(svc.cfg.ShortenerPrefix))
+	return svc.repo.DeleteLink(ctx, urlid)
+}
+
+// Purge permanently removes links deleted longer than the configured retention ago.
+// Their ids are kept as tombstones, so the short URLs keep answering 410 Gone.
+func (svc *Service) Purge(ctx context.Context) (purged int64, err error) {
+	ctx, span := tracer.Start(ctx, "Service.Purge")
+	defer tracing.End(span, &err)
+
+	return svc.repo.Purge(ctx, time.Now().Add(-svc.cfg.PurgeRetention))
+}
+
+// RunPurge purges deleted links every cfg.PurgeInterval until ctx is done.
+// A zero cfg.PurgeRetention disables purging.
+func (svc *Service) RunPurge(ctx context.Context) {
+	if svc.cfg.PurgeRetention <= 0 || svc.cfg.PurgeInterval <= 0 {
+		svc.logger.Info("purging of deleted links is disabled")
+		return
+	}
+	if svc.cfg.RestoreWindow <= 0 || svc.cfg.RestoreWindow > svc.cfg.PurgeRetention {
+		svc.logger.Warn("deleted links are purged before the end of the restore window",
+			zap.Duration("retention", svc.cfg.PurgeRetention), zap.Duration("restore_window", svc.cfg.RestoreWindow))
+	}
+
+	ticker := time.NewTicker(svc.cfg.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := svc.Purge(ctx)
+		if err != nil {
+			svc.logger.Error("failed to purge deleted links", zap.Error(err))
+		} else if purged > 0 {
+			svc.logger.Info("purged deleted links", zap.Int64("count", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RenormalizeURLs brings the normalized forms of stored URLs in line with the current normalization settings,
+// so links saved before normalization or under other settings are found as duplicates.
+// It must run before the service starts accepting requests.
+func (svc *Service) RenormalizeURLs(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "Service.RenormalizeURLs")
+	defer tracing.End(span, &err)
+
+	updated, err := svc.repo.Renormalize(ctx, svc.normalizeURL)
+	if err != nil {
+		return fmt.Errorf("failed to renormalize urls: %w", err)
+	}
+	if updated > 0 {
+		svc.logger.Info("renormalized stored urls", zap.Int64("count", updated))
+	}
+	return nil
+}
+
+// Lengthen resolves a short identifier back to the original URL for the given kind of visit.
+// Previews and the visits of links forcing the interstitial page return the destination with Preview set;
+// only the visits redirecting to the URL are counted and reported as follow events.
+// A confirmed visit must carry the token of the continue link of the preview page, otherwise it is a plain follow.
+// Links to destinations forbidden by the policy after they were shortened are unavailable with HTTP 451.
+func (svc *Service) Lengthen(ctx context.Context, id string, visit model.Visit, confirmToken string) (dest model.Destination, err error) {
+	ctx, span := tracer.Start(ctx, "Service.Lengthen")
+	defer tracing.End(span, &err)
+
+	urlid, err := model.ParseURLID(id)
+	if err != nil {
+		return model.Destination{}, err
+	}
+
+	now := time.Now()
+	if visit == model.VisitConfirmed && !svc.validConfirmToken(urlid, confirmToken, now) {
+		visit = model.VisitFollow
+	}
+
+	// the click is counted only once the destination passes the policy
+	link, err := svc.repo.Get(ctx, urlid)
+	if err != nil {
+		if visit != model.VisitPreview {
+			svc.fire(ctx, model.ActionFollow, link.URL)
+		}
+		return model.Destination{}, err
+	}
+	err = svc.checkDestination(ctx, link.URL, http.StatusUnavailableForLegalReasons)
+	if err != nil {
+		return model.Destination{}, err
+	}
+
+	dest = model.Destination{
+		ShortURL:  urlid.AsURL(svc.cfg.ShortenerPrefix),
+		URL:       link.URL,
+		Title:     link.Title,
+		CreatedAt: link.CreatedAt,
+		Preview:   !visit.Redirects(link.Interstitial),
+	}
+	if dest.Preview {
+		dest.ContinueURL = svc.confirmURL(urlid, now)
+		return dest, nil
+	}
+
+	err = svc.repo.CountClick(ctx, urlid)
+	if err != nil {
+		return model.Destination{}, err
+	}
+	svc.fire(ctx, model.ActionFollow, link.URL)
+	return dest, nil
+}
+
+// QRCode renders the QR code of the absolute short URL of the link.
+// Rendering the code of a deleted or unknown link fails; it does not count as a visit of the link.
+func (svc *Service) QRCode(ctx context.Context, id string, opts qrcode.Options) (img []byte, err error) {
+	ctx, span := tracer.Start(ctx, "Service.QRCode")
+	defer tracing.End(span, &err)
+
+	urlid, err := model.ParseURLID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opts.Format != qrcode.FormatPNG && opts.Format != qrcode.FormatSVG:
+		msg := fmt.Sprintf("invalid format %q: must be %q or %q", opts.Format, qrcode.FormatPNG, qrcode.FormatSVG)
+		return nil, errs.NewHTTPError(msg, http.StatusBadRequest)
+	case !slices.Contains(qrcode.Levels, opts.Level):
+		msg := fmt.Sprintf("invalid level %q: must be one of %s", opts.Level, strings.Join(qrcode.Levels, ", "))
+		return nil, errs.NewHTTPError(msg, http.StatusBadRequest)
+	case opts.Size <= 0 || opts.Size > maxQRSize:
+		msg := fmt.Sprintf("invalid size %d: must be from 1 to %d", opts.Size, maxQRSize)
+		return nil, errs.NewHTTPError(msg, http.StatusBadRequest)
+	case opts.Margin < 0 || opts.Margin > maxQRMargin:
+		msg := fmt.Sprintf("invalid margin %d: must be from 0 to %d", opts.Margin, maxQRMargin)
+		return nil, errs.NewHTTPError(msg, http.StatusBadRequest)
+	}
+
+	_, err = svc.repo.Get(ctx, urlid)
+	if err != nil {
+		return nil, err
 	}
 
-	url, err := svc.repo.Get(ctx, urlid)
-	svc.fire(ctx, model.ActionFollow, url)
-	return url, err
+	img, err = qrcode.Encode(urlid.AsURL(svc.cfg.ShortenerPrefix), opts)
+	var sizeErr *qrcode.SizeError
+	if errors.As(err, &sizeErr) {
+		return nil, errs.NewHTTPError(err.Error(), http.StatusBadRequest)
+	}
+	return img, err
 }
 
-// Subscribe registers an AuditSubscriber that will be notified about URL creation events.
+// Subscribe registers an AuditSubscriber that will be notified about audit events.
 func (svc *Service) Subscribe(sub AuditSubscriber) {
 	svc.subs = append(svc.subs, sub)
 }
 
+// SetPolicy sets the policy checked for the destinations of shortened and followed links.
+func (svc *Service) SetPolicy(policy DestinationPolicy) {
+	svc.policy = policy
+}
+
+// SetAuditReader sets the storage used to answer audit queries.
+func (svc *Service) SetAuditReader(reader AuditReader) {
+	svc.reader = reader
+}
+
+// QueryAudit returns stored audit events matching the query.
+// Only users listed in the AdminUsers configuration are allowed to query the audit log.
+func (svc *Service) QueryAudit(ctx context.Context, q model.AuditQuery) (page model.AuditPage, err error) {
+	ctx, span := tracer.Start(ctx, "Service.QueryAudit")
+	defer tracing.End(span, &err)
+
+	userID, err := repository.GetUserID(ctx)
+	if err != nil {
+		return model.AuditPage{}, err
+	}
+	if !slices.Contains(svc.cfg.AdminUsers, userID) {
+		return model.AuditPage{}, errs.NewHTTPError("admin access required", http.StatusForbidden)
+	}
+	if svc.reader == nil {
+		return model.AuditPage{}, errs.NewHTTPError("audit log storage is not configured", http.StatusNotFound)
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = defaultAuditPageSize
+	}
+	q.Limit = min(q.Limit, maxAuditPageSize)
+	return svc.reader.QueryAudit(ctx, q)
+}
+
 func (svc *Service) fire(ctx context.Context, action model.AuditAction, url string) {
+	svc.fireOutcome(ctx, action, url, "")
+}
+
+func (svc *Service) fireOutcome(ctx context.Context, action model.AuditAction, url, outcome string) {
 	userID, err := repository.GetUserID(ctx)
 	if err != nil {
-		svc.logger.Error("audit event handling error", zap.Error(err))
+		logger.FromContext(ctx, svc.logger).Error("audit event handling error", zap.Error(err))
 	}
+	svc.fireEvt(ctx, model.AuditEvent{UserID: userID, Action: action, URL: url, Outcome: outcome})
+}
+
+func (svc *Service) fireEvt(ctx context.Context, evt model.AuditEvent) {
+	evt.TS = time.Now().Unix()
 	ctx, cancel := context.WithTimeout(ctx, svc.cfg.AuditURLTimeout)
 	defer cancel()
 	for _, sub := range svc.subs {
-		err = sub.OnAuditEvt(ctx, userID, action, url)
+		err := sub.OnAuditEvt(ctx, evt)
 		if err != nil {
-			svc.logger.Error("audit event handling error", zap.Error(err))
+			logger.FromContext(ctx, svc.logger).Error("audit event handling error", zap.Error(err))
+		}
+	}
+}
+
+func (svc *Service) onDeleted(results []model.DeleteResult) {
+	for _, res := range results {
+		action := model.ActionDeleteApplied
+		if res.Restore {
+			action = model.ActionRestoreApplied
 		}
+		svc.fireEvt(context.Background(), model.AuditEvent{
+			UserID:  res.UserID,
+			Action:  action,
+			URL:     res.URLID.AsURL(svc.cfg.ShortenerPrefix),
+			Outcome: string(res.Outcome),
+		})
 	}
 }
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kuznet1/urlshrt/internal/errs"
+	"github.com/kuznet1/urlshrt/internal/model"
+	"golang.org/x/net/idna"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// defaultURLSchemes are the schemes of URLs accepted for shortening when no list is configured.
+var defaultURLSchemes = []string{"http", "https"}
+
+func invalidURL(format string, args ...any) error {
+	return errs.NewHTTPError(fmt.Sprintf(format, args...), http.StatusBadRequest)
+}
+
+// checkURL validates a URL to shorten and returns it with surrounding spaces trimmed and
+// an internationalized host name converted to its ASCII (punycode) form.
+// The URL must be absolute, use an allowed scheme, have a valid host and no credentials,
+// and fit into the configured length limit.
+func (svc *Service) checkURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", invalidURL("url is empty")
+	}
+	err := svc.checkURLLength(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsFunc(rawURL, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) {
+		return "", invalidURL("url contains spaces or control characters")
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", invalidURL("invalid url: %s", errors.Unwrap(err))
+	}
+	if !u.IsAbs() {
+		return "", invalidURL("url must be absolute, e.g. https://example.com/")
+	}
+
+	schemes := svc.cfg.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = defaultURLSchemes
+	}
+	if !slices.ContainsFunc(schemes, func(s string) bool { return strings.EqualFold(s, u.Scheme) }) {
+		return "", invalidURL("url scheme %q is not allowed, allowed schemes: %s", u.Scheme, strings.Join(schemes, ", "))
+	}
+	if u.Opaque != "" {
+		// URLs without authority, such as mailto:, are accepted as is if their scheme is allowed
+		return rawURL, nil
+	}
+	if u.User != nil {
+		return "", invalidURL("url must not contain credentials")
+	}
+
+	host, err := checkHost(u)
+	if err != nil {
+		return "", err
+	}
+	if host == u.Host {
+		return rawURL, nil
+	}
+
+	// replace the host only, keeping the rest of the URL as given
+	prefix := len(u.Scheme) + len("://")
+	rest := rawURL[prefix:]
+	authorityEnd := strings.IndexAny(rest, "/?#")
+	if authorityEnd < 0 {
+		authorityEnd = len(rest)
+	}
+	res := rawURL[:prefix] + host + rest[authorityEnd:]
+	return res, svc.checkURLLength(res)
+}
+
+// checkURLLength rejects URLs longer than the configured limit.
+func (svc *Service) checkURLLength(url string) error {
+	if svc.cfg.MaxURLLength > 0 && len(url) > svc.cfg.MaxURLLength {
+		return invalidURL("url is %d bytes long, the limit is %d bytes", len(url), svc.cfg.MaxURLLength)
+	}
+	return nil
+}
+
+// checkHost validates the host and the port of the URL and returns the host in the ASCII form.
+func checkHost(u *url.URL) (string, error) {
+	hostname, port := u.Hostname(), u.Port()
+	if hostname == "" {
+		return "", invalidURL("url has no host")
+	}
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return "", invalidURL("invalid port %q", port)
+		}
+	}
+
+	if net.ParseIP(hostname) != nil {
+		return u.Host, nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return "", invalidURL("invalid host %q: %s", hostname, err)
+	}
+	if port != "" {
+		return net.JoinHostPort(ascii, port), nil
+	}
+	return ascii, nil
+}
+
+// defaultPorts are the ports removed from normalized URLs of the corresponding schemes.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// trackingParams are the query parameters stripped from normalized URLs if cfg.NormalizeStripTracking is set.
+// Names ending with "*" are prefixes.
+var trackingParams = []string{"utm_*", "fbclid", "gclid", "yclid", "msclkid", "mc_eid"}
+
+// normalizeURL returns the canonical form of a valid URL used to find duplicates: the scheme and the host
+// are lowercased, the default port and the dot segments of the path are removed, an empty path becomes "/"
+// and an empty query is dropped. Tracking parameters are stripped and the query is sorted if configured.
+// If cfg.NormalizeURLs is not set, the URL is returned as is.
+func (svc *Service) normalizeURL(rawURL string) string {
+	if !svc.cfg.NormalizeURLs {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Opaque != "" {
+		return u.String()
+	}
+
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	u.Path = removeDotSegments(u.Path)
+	u.RawPath = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	u.RawQuery = svc.normalizeQuery(u.RawQuery)
+	u.ForceQuery = false
+	return u.String()
+}
+
+// normalizeQuery strips tracking parameters and sorts the parameters if configured,
+// keeping the encoding of the parameters as is.
+func (svc *Service) normalizeQuery(query string) string {
+	if query == "" {
+		return ""
+	}
+
+	var params []string
+	for _, param := range strings.Split(query, "&") {
+		if param == "" || (svc.cfg.NormalizeStripTracking && isTrackingParam(param)) {
+			continue
+		}
+		params = append(params, param)
+	}
+	if svc.cfg.NormalizeSortQuery {
+		slices.Sort(params)
+	}
+	return strings.Join(params, "&")
+}
+
+func isTrackingParam(param string) bool {
+	name, _, _ := strings.Cut(param, "=")
+	name = strings.ToLower(name)
+	return slices.ContainsFunc(trackingParams, func(tracking string) bool {
+		if prefix, ok := strings.CutSuffix(tracking, "*"); ok {
+			return strings.HasPrefix(name, prefix)
+		}
+		return name == tracking
+	})
+}
+
+// removeDotSegments removes "." and ".." segments from the path as described in RFC 3986, section 5.2.4.
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+
+	segments := strings.Split(path, "/")
+	res := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				res = append(res, "")
+			}
+		case "..":
+			if len(res) > 1 {
+				res = res[:len(res)-1]
+			}
+			if last {
+				res = append(res, "")
+			}
+		default:
+			res = append(res, segment)
+		}
+	}
+	return strings.Join(res, "/")
+}
+
+// checkDestination rejects the URL with the given status code if the destination policy forbids it,
+// reporting the attempt to the audit log.
+func (svc *Service) checkDestination(ctx context.Context, url string, code int) error {
+	if svc.policy == nil {
+		return nil
+	}
+	err := svc.policy.Check(url)
+	if err == nil {
+		return nil
+	}
+
+	svc.fireOutcome(ctx, model.ActionBlocked, url, err.Error())
+	return errs.NewHTTPError("destination is blocked: "+err.Error(), code)
+}
@@ -0,0 +1,17 @@
+BEGIN;
+
+CREATE TABLE audit_events
+(
+    id      BIGSERIAL PRIMARY KEY,
+    ts      BIGINT NOT NULL,
+    action  TEXT   NOT NULL,
+    user_id INT    NOT NULL,
+    url     TEXT   NOT NULL,
+    outcome TEXT   NOT NULL DEFAULT ''
+);
+
+CREATE INDEX audit_events_user_id_idx ON audit_events (user_id, id);
+CREATE INDEX audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX audit_events_ts_idx ON audit_events (ts);
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX IF EXISTS links_user_id_clicks_idx;
+DROP INDEX IF EXISTS links_user_id_idx;
+
+ALTER TABLE links
+    DROP COLUMN IF EXISTS clicks,
+    DROP COLUMN IF EXISTS created_at;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE links
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN clicks     BIGINT      NOT NULL DEFAULT 0;
+
+CREATE INDEX links_user_id_idx ON links (user_id, id);
+CREATE INDEX links_user_id_clicks_idx ON links (user_id, clicks, id);
+
+COMMIT;
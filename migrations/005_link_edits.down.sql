@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP TABLE IF EXISTS link_edits;
+
+ALTER TABLE links
+    DROP COLUMN IF EXISTS title;
+
+COMMIT;
@@ -0,0 +1,20 @@
+BEGIN;
+
+ALTER TABLE links
+    ADD COLUMN title TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE link_edits
+(
+    id        BIGSERIAL PRIMARY KEY,
+    link_id   INT         NOT NULL REFERENCES links (id) ON DELETE CASCADE,
+    user_id   INT         NOT NULL,
+    edited_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    old_url   TEXT        NOT NULL,
+    new_url   TEXT        NOT NULL,
+    old_title TEXT        NOT NULL,
+    new_title TEXT        NOT NULL
+);
+
+CREATE INDEX link_edits_link_id_idx ON link_edits (link_id, id);
+
+COMMIT;
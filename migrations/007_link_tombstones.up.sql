@@ -0,0 +1,7 @@
+CREATE TABLE link_tombstones
+(
+    id         INT PRIMARY KEY,
+    user_id    INT,
+    deleted_at TIMESTAMPTZ,
+    purged_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
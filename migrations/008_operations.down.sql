@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS operation_items;
+DROP TABLE IF EXISTS operations;
+
+COMMIT;
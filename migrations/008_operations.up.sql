@@ -0,0 +1,22 @@
+BEGIN;
+
+CREATE TABLE operations
+(
+    id         TEXT PRIMARY KEY,
+    user_id    INT         NOT NULL,
+    restore    BOOLEAN     NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX operations_created_at_idx ON operations (created_at);
+
+CREATE TABLE operation_items
+(
+    operation_id TEXT   NOT NULL REFERENCES operations (id) ON DELETE CASCADE,
+    position     INT    NOT NULL,
+    url_id       BIGINT NOT NULL,
+    outcome      TEXT   NOT NULL DEFAULT '',
+    PRIMARY KEY (operation_id, position)
+);
+
+COMMIT;
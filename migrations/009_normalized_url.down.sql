@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP INDEX IF EXISTS links_normalized_url_idx;
+
+ALTER TABLE links
+    DROP COLUMN IF EXISTS normalized_url;
+
+ALTER TABLE links
+    ADD CONSTRAINT links_url_key UNIQUE (url);
+
+COMMIT;
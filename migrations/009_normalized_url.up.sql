@@ -0,0 +1,17 @@
+BEGIN;
+
+ALTER TABLE links
+    ADD COLUMN normalized_url TEXT;
+
+UPDATE links
+SET normalized_url = url;
+
+ALTER TABLE links
+    ALTER COLUMN normalized_url SET NOT NULL;
+
+ALTER TABLE links
+    DROP CONSTRAINT IF EXISTS links_url_key;
+
+CREATE UNIQUE INDEX links_normalized_url_idx ON links (normalized_url);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE links
+    ADD COLUMN interstitial BOOLEAN NOT NULL DEFAULT false;
+
+COMMIT;